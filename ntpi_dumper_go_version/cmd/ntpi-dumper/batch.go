@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/fatih/color"
+)
+
+var failFast bool
+
+func init() {
+	rootCmd.Flags().BoolVar(&failFast, "fail-fast", false, "With several archives, stop at the first one that fails")
+}
+
+// archiveResult is the outcome of one archive of a batch
+type archiveResult struct {
+	Input    string        `json:"input"`
+	Output   string        `json:"output"`
+	OK       bool          `json:"ok"`
+	Skipped  bool          `json:"skipped,omitempty"` // Not attempted because of --fail-fast
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"-"`
+	err      error
+}
+
+// batchEvent is the payload of the "batch_summary" event
+type batchEvent struct {
+	OK         bool            `json:"ok"`
+	Total      int             `json:"archives_total"`
+	Succeeded  int             `json:"archives_ok"`
+	DurationMS int64           `json:"duration_ms"`
+	Archives   []archiveResult `json:"archives"`
+}
+
+// collectInputs expands the command line into NTPI files. Directories yield
+// the *.ntpi files directly inside them and glob patterns are expanded here,
+// since Windows shells do not. Files named more than once are kept once.
+func collectInputs(args []string) ([]string, error) {
+	var inputs []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		key := path
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		if !seen[key] {
+			seen[key] = true
+			inputs = append(inputs, path)
+		}
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match: %s", arg)
+			}
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && !info.IsDir() {
+					add(match)
+				}
+			}
+			continue
+		}
+
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("input file not found: %s", arg)
+		}
+		if !info.IsDir() {
+			add(arg)
+			continue
+		}
+
+		files, err := archivesInDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no .ntpi files in directory: %s", arg)
+		}
+		for _, file := range files {
+			add(file)
+		}
+	}
+
+	return inputs, nil
+}
+
+// archivesInDir lists the .ntpi files directly inside dir, sorted by name
+func archivesInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".ntpi") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// outputDirs picks the output directory of every input by expanding a
+// template (see outputTemplateHelp). Without --output-template, -o names the
+// output of a single input, or the parent directory of one subdirectory per
+// input in a batch; the default is {dir}/{name}_extracted. With
+// --output-template, the template is placed under -o.
+func outputDirs(inputs []string, output, layout string) ([]string, error) {
+	template := output
+	switch {
+	case layout != "":
+		template = filepath.Join(output, layout)
+	case template == "":
+		template = filepath.Join("{dir}", "{name}_extracted")
+	case len(inputs) > 1 && !strings.Contains(template, "{"):
+		template = filepath.Join(template, "{name}")
+	}
+
+	outputs := make([]string, len(inputs))
+	used := make(map[string]string)
+	for i, input := range inputs {
+		dir, err := expandTemplate(template, input)
+		if err != nil {
+			return nil, err
+		}
+
+		key := dir
+		if abs, err := filepath.Abs(dir); err == nil {
+			key = abs
+		}
+		if other, ok := used[key]; ok {
+			return nil, fmt.Errorf("%w: %s and %s would both be extracted to %s; add a distinguishing placeholder such as {name} or {sha256}",
+				errBadTemplate, other, input, dir)
+		}
+		used[key] = input
+		outputs[i] = dir
+	}
+
+	return outputs, nil
+}
+
+// runBatch extracts every input through the shared pool in opts. While one
+// archive is extracted, the next one is parsed and starts feeding its blocks
+// into the same pool, so the workers do not idle between archives. The
+// output of that second archive is held back until the first is done. A
+// failed archive does not stop the rest unless --fail-fast is set, which
+// also stops the overlap so nothing starts before the previous archive
+// succeeded.
+func runBatch(inputs, outputs []string, opts extractor.Options) []archiveResult {
+	lookahead := 1
+	if failFast {
+		lookahead = 0
+	}
+
+	results := make([]archiveResult, len(inputs))
+	runs := make([]*batchRun, len(inputs))
+	stopped := false
+	for i, input := range inputs {
+		results[i] = archiveResult{Input: input, Output: outputs[i]}
+		if stopped {
+			results[i].Skipped = true
+			continue
+		}
+
+		for next := i; next <= i+lookahead && next < len(inputs); next++ {
+			if runs[next] == nil {
+				runs[next] = startBatchRun(next, len(inputs), inputs[next], outputs[next], opts, next > i)
+			}
+		}
+		run := runs[i]
+		run.out.release()
+		<-run.done
+
+		results[i].Duration = run.duration
+		results[i].OK = run.err == nil
+		if run.err != nil {
+			results[i].err = run.err
+			results[i].Error = run.err.Error()
+			logger.Errorf("%s: %v", input, run.err)
+			stopped = failFast
+		}
+	}
+
+	return results
+}
+
+// batchRun is one archive of a batch being extracted
+type batchRun struct {
+	out      *archiveOutput
+	done     chan struct{} // Closed once err and duration are set
+	err      error
+	duration time.Duration
+}
+
+// startBatchRun starts extracting the archive at position i of n. In the
+// background, its output is held back until the run is released.
+func startBatchRun(i, n int, input, output string, opts extractor.Options, background bool) *batchRun {
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	run := &batchRun{out: foregroundOutput(), done: make(chan struct{})}
+	if background {
+		run.out = backgroundOutput()
+	}
+	go func() {
+		defer close(run.done)
+		run.out.logger.Infof("\n%s", cyan(fmt.Sprintf("=== Archive %d/%d: %s ===", i+1, n, input)))
+		start := time.Now()
+		run.err = runArchive(input, output, opts, run.out)
+		run.duration = time.Since(start)
+	}()
+	return run
+}
+
+// heldWriter buffers writes until release, then writes them to w and passes
+// later writes straight through
+type heldWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	buf     bytes.Buffer
+	holding bool
+}
+
+func (h *heldWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holding {
+		return h.buf.Write(p)
+	}
+	return h.w.Write(p)
+}
+
+// release writes the buffered output and stops holding
+func (h *heldWriter) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holding {
+		h.w.Write(h.buf.Bytes())
+		h.buf.Reset()
+		h.holding = false
+	}
+}
+
+// isHolding reports whether writes are still buffered
+func (h *heldWriter) isHolding() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.holding
+}
+
+// printBatchSummary prints the outcome of every archive and returns the exit
+// code: that of the most specific failure, as for a single archive
+func printBatchSummary(results []archiveResult, elapsed time.Duration) int {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	succeeded := 0
+	var errs []error
+	logger.Infof("\n%s", cyan("=== Batch Summary ==="))
+	for _, result := range results {
+		switch {
+		case result.OK:
+			succeeded++
+			logger.Infof("  %s  %s -> %s (%s)", green("OK     "), result.Input, result.Output,
+				result.Duration.Round(time.Millisecond))
+		case result.Skipped:
+			logger.Infof("  %s  %s", yellow("SKIPPED"), result.Input)
+		default:
+			errs = append(errs, result.err)
+			logger.Infof("  %s  %s: %s", red("FAILED "), result.Input, result.Error)
+		}
+	}
+
+	countColor := green
+	if succeeded != len(results) {
+		countColor = red
+	}
+	logger.Infof("Archives: %s / %d succeeded", countColor(fmt.Sprintf("%d", succeeded)), len(results))
+	logger.Infof("Total time: %s (%.2f seconds / %.2f minutes)",
+		cyan(elapsed.Round(time.Second).String()), elapsed.Seconds(), elapsed.Minutes())
+
+	events.Emit("batch_summary", batchEvent{
+		OK:         succeeded == len(results),
+		Total:      len(results),
+		Succeeded:  succeeded,
+		DurationMS: elapsed.Milliseconds(),
+		Archives:   results,
+	})
+
+	if succeeded == len(results) {
+		return ExitOK
+	}
+	if len(errs) == 0 {
+		return ExitFailure
+	}
+	return exitCode(errors.Join(errs...))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/internal/ntpitest"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
+)
+
+// lockedBuffer is a bytes.Buffer several loggers can write to
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRunBatch(t *testing.T) {
+	var out lockedBuffer
+	logOut, logLevel = &out, logging.LevelInfo
+	logger = logging.NewLogger(logOut, logLevel)
+	progressMode, events, tempRoot = progress.ModeNone, nil, t.TempDir()
+
+	var inputs, outputs []string
+	var files [][]ntpitest.File
+	for i := 0; i < 3; i++ {
+		data := bytes.Repeat([]byte{byte(i + 1)}, 2*ntpitest.BlockSize+i)
+		archive := []ntpitest.File{{Name: "boot.img", Data: data}}
+		files = append(files, archive)
+		inputs = append(inputs, ntpitest.Write(t, archive...))
+		outputs = append(outputs, filepath.Join(t.TempDir(), "out"))
+	}
+
+	pool, err := extractor.NewPool(extractor.Options{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	results := runBatch(inputs, outputs, extractor.Options{Pool: pool})
+	for i, result := range results {
+		if !result.OK {
+			t.Fatalf("archive %d: %s", i, result.Error)
+		}
+		data, err := os.ReadFile(filepath.Join(outputs[i], "boot.img"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, files[i][0].Data) {
+			t.Errorf("archive %d: boot.img differs", i)
+		}
+	}
+
+	// Archives run side by side, but their output must not interleave
+	log := out.String()
+	last := -1
+	for _, heading := range []string{
+		"=== Archive 1/3", "=== Extraction Summary",
+		"=== Archive 2/3", "=== Extraction Summary",
+		"=== Archive 3/3", "=== Extraction Summary",
+	} {
+		i := strings.Index(log[last+1:], heading)
+		if i < 0 {
+			t.Fatalf("%q missing or out of order in:\n%s", heading, log)
+		}
+		last += 1 + i
+	}
+}
+
+func TestHeldWriter(t *testing.T) {
+	var out bytes.Buffer
+	h := &heldWriter{w: &out, holding: true}
+	h.Write([]byte("a"))
+	h.Write([]byte("b"))
+	if out.Len() != 0 {
+		t.Fatalf("wrote %q while holding", out.String())
+	}
+	h.release()
+	h.Write([]byte("c"))
+	if out.String() != "abc" || h.isHolding() {
+		t.Errorf("after release: %q", out.String())
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variable of every flag, e.g.
+// NTPI_DUMPER_WORKERS for --workers
+const envPrefix = "NTPI_DUMPER_"
+
+var configPath string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration file and environment defaults",
+	Long: `Every command-line flag can also be set in a configuration file or through
+an environment variable. For each flag, the first of these wins:
+
+  1. the command line
+  2. the environment variable NTPI_DUMPER_<FLAG>, e.g. NTPI_DUMPER_WORKERS=8
+     or NTPI_DUMPER_OUTPUT_TEMPLATE={device}/{version}
+  3. the configuration file: --config, NTPI_DUMPER_CONFIG, or
+     ntpi-dumper/config.toml in the user configuration directory
+  4. the built-in default
+
+The configuration file holds "flag = value" lines using long flag names.
+Lines in a [command] section, e.g. [bench], only apply to that subcommand
+and override the lines above the first section:
+
+  # ~/.config/ntpi-dumper/config.toml
+  workers = 8
+  output = "/srv/firmware"
+  output-template = "{device}/{version}/{build}"
+  decoder = "liblzma"
+  exclude = "userdata*,cache.img"
+
+  [bench]
+  samples = 32`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [command]",
+	Short: "Print the effective configuration and where each value came from",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runConfigShow,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Configuration file (default: ntpi-dumper/config.toml in the user config directory)")
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// configFile holds the values of a parsed configuration file
+type configFile struct {
+	path     string
+	global   map[string]configValue            // Keys before the first section
+	sections map[string]map[string]configValue // Keys under [command]
+}
+
+// configValue is one "key = value" line
+type configValue struct {
+	value string
+	line  int
+}
+
+// flagSource records a flag's effective value and where it came from
+type flagSource struct {
+	name   string
+	value  string
+	origin string
+}
+
+// defaultConfigPath returns the config file in the user configuration directory
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ntpi-dumper", "config.toml")
+}
+
+// configLocation returns the configuration file to read and whether it was
+// chosen explicitly, by --config or NTPI_DUMPER_CONFIG
+func configLocation(flagGiven bool) (string, bool) {
+	if flagGiven {
+		return configPath, true
+	}
+	if env := os.Getenv(envName("config")); env != "" {
+		return env, true
+	}
+	return defaultConfigPath(), false
+}
+
+// loadConfig reads the configuration file. A missing default file is not an
+// error; a missing explicit one is.
+func loadConfig(flagGiven bool) (*configFile, error) {
+	path, explicit := configLocation(flagGiven)
+	if path == "" {
+		return nil, nil
+	}
+
+	config, err := parseConfig(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseConfig parses a configuration file of "key = value" lines, [section]
+// headers and # comments. Values may be double-quoted.
+func parseConfig(path string) (*configFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer f.Close()
+
+	config := &configFile{
+		path:     path,
+		global:   make(map[string]configValue),
+		sections: make(map[string]map[string]configValue),
+	}
+	values := config.global
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			if findCommand(section) == nil {
+				return nil, fmt.Errorf("%s:%d: unknown command [%s]", path, lineNo, section)
+			}
+			if config.sections[section] == nil {
+				config.sections[section] = make(map[string]configValue)
+			}
+			values = config.sections[section]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"flag = value\"", path, lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value %s", path, lineNo, value)
+			}
+			value = unquoted
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		values[key] = configValue{value: value, line: lineNo}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return config, nil
+}
+
+// validate rejects keys that are not a flag of the command they apply to,
+// so typos do not go unnoticed. Keys before the first section may be a flag
+// of any command.
+func (c *configFile) validate() error {
+	known := make(map[string]bool)
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		visitFlags(cmd, func(f *pflag.Flag) { known[f.Name] = true })
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(rootCmd)
+
+	for key, v := range c.global {
+		if !known[key] || !configurable(key) {
+			return fmt.Errorf("%s:%d: unknown setting %q", c.path, v.line, key)
+		}
+	}
+	for section, values := range c.sections {
+		cmd := findCommand(section)
+		for key, v := range values {
+			if lookupFlag(cmd, key) == nil || !configurable(key) {
+				return fmt.Errorf("%s:%d: %s has no setting %q", c.path, v.line, section, key)
+			}
+		}
+	}
+	return nil
+}
+
+// lookup finds a flag's value for cmd: the command's own section wins over
+// the keys before the first section
+func (c *configFile) lookup(cmd *cobra.Command, name string) (configValue, bool) {
+	if c == nil {
+		return configValue{}, false
+	}
+	if value, ok := c.sections[cmd.Name()][name]; ok && cmd != rootCmd {
+		return value, true
+	}
+	value, ok := c.global[name]
+	return value, ok
+}
+
+// findCommand returns the subcommand called name, or nil
+func findCommand(name string) *cobra.Command {
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// visitFlags calls fn for every flag of cmd, including the persistent flags
+// it inherits, even before cmd has parsed its arguments
+func visitFlags(cmd *cobra.Command, fn func(*pflag.Flag)) {
+	cmd.LocalFlags().VisitAll(fn)
+	cmd.InheritedFlags().VisitAll(fn)
+}
+
+// lookupFlag returns the flag of cmd called name, or nil
+func lookupFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if f := cmd.LocalFlags().Lookup(name); f != nil {
+		return f
+	}
+	return cmd.InheritedFlags().Lookup(name)
+}
+
+// configurable reports whether a flag may be set from the environment or a
+// config file
+func configurable(name string) bool {
+	switch name {
+	case "help", "version", "config":
+		return false
+	}
+	return true
+}
+
+// envName returns the environment variable for a flag
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyConfig fills every flag of cmd that was not given on the command line
+// from the environment or the configuration file, and returns the effective
+// value of each flag and where it came from
+func applyConfig(cmd *cobra.Command, configFlagGiven bool) ([]flagSource, error) {
+	config, err := loadConfig(configFlagGiven)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []flagSource
+	var firstErr error
+	visitFlags(cmd, func(f *pflag.Flag) {
+		if !configurable(f.Name) || firstErr != nil {
+			return
+		}
+
+		origin := "default"
+		if f.Changed {
+			origin = "command line"
+		} else if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			origin = envName(f.Name)
+			firstErr = setFlag(f, value, origin)
+		} else if value, ok := config.lookup(cmd, f.Name); ok {
+			origin = fmt.Sprintf("%s:%d", config.path, value.line)
+			firstErr = setFlag(f, value.value, origin)
+		}
+		sources = append(sources, flagSource{name: f.Name, value: f.Value.String(), origin: origin})
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return sources, nil
+}
+
+// setFlag sets a flag from a configuration source
+func setFlag(f *pflag.Flag, value, origin string) error {
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("%s: invalid value %q for --%s: %w", origin, value, f.Name, err)
+	}
+	return nil
+}
+
+// runConfigShow prints the effective configuration of the extraction command,
+// or of the named subcommand
+func runConfigShow(cmd *cobra.Command, args []string) {
+	target := rootCmd
+	if len(args) > 0 {
+		target = findCommand(args[0])
+		if target == nil || target == configCmd {
+			fatalUsage(fmt.Errorf("unknown command %q", args[0]))
+		}
+	}
+
+	configFlagGiven := cmd.Flags().Changed("config")
+	sources, err := applyConfig(target, configFlagGiven)
+	if err != nil {
+		fatalUsage(err)
+	}
+
+	path, _ := configLocation(configFlagGiven)
+	if _, err := os.Stat(path); err != nil {
+		path += " (not found)"
+	}
+	fmt.Printf("Config file: %s\n\n", path)
+
+	sort.Slice(sources, func(i, j int) bool { return sources[i].name < sources[j].name })
+	fmt.Printf("%-18s %-34s %s\n", "Setting", "Value", "Source")
+	for _, source := range sources {
+		value := source.value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Printf("%-18s %-34s %s\n", source.name, value, source.origin)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// writeConfig writes a configuration file and points --config at it
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath = path
+	t.Cleanup(func() { configPath = "" })
+}
+
+// resetFlags restores the defaults of cmd's flags after a test
+func resetFlags(t *testing.T, cmd *cobra.Command) {
+	t.Cleanup(func() {
+		visitFlags(cmd, func(f *pflag.Flag) {
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		})
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	writeConfig(t, `# comment
+workers = 4
+output = "/srv/firmware # not a comment"
+decoder = go # comment
+
+[bench]
+samples = 32
+`)
+	config, err := parseConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"workers": "4", "output": "/srv/firmware # not a comment", "decoder": "go"}
+	for key, value := range want {
+		if got := config.global[key].value; got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if got := config.sections["bench"]["samples"]; got.value != "32" || got.line != 7 {
+		t.Errorf("[bench] samples = %+v, want 32 on line 7", got)
+	}
+
+	for _, bad := range []string{"workers", "[nosuchcommand]", `output = "unterminated`} {
+		writeConfig(t, bad+"\n")
+		if _, err := parseConfig(configPath); err == nil {
+			t.Errorf("parseConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	resetFlags(t, benchCmd)
+	writeConfig(t, `samples = 1
+time = "1m"
+workers = 1
+temp-dir = "/global"
+
+[bench]
+samples = 2
+time = "2m"
+workers = 2
+`)
+	t.Setenv(envName("samples"), "3")
+	t.Setenv(envName("time"), "3m")
+	if err := benchCmd.Flags().Set("samples", "4"); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := applyConfig(benchCmd, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]flagSource)
+	for _, source := range sources {
+		got[source.name] = source
+	}
+
+	tests := []struct {
+		flag, value, origin string
+	}{
+		{"samples", "4", "command line"},
+		{"time", "3m0s", envName("time")},
+		{"workers", "2", configPath + ":9"},
+		{"temp-dir", "/global", configPath + ":4"},
+		{"log-file", "", "default"},
+	}
+	for _, tt := range tests {
+		source := got[tt.flag]
+		if source.value != tt.value || source.origin != tt.origin {
+			t.Errorf("--%s = %q from %s, want %q from %s", tt.flag, source.value, source.origin, tt.value, tt.origin)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
+)
+
+var eventsOut io.Writer // Destination of events, for archives extracted in the background
+
+// setupEvents parses --progress and, for json, opens the event stream on
+// --progress-fd. When events go to stdout, human-readable output is moved to
+// stderr so the stream stays valid NDJSON.
+func setupEvents() error {
+	mode, err := progress.ParseMode(progressArg)
+	if err != nil {
+		return err
+	}
+	progressMode = mode
+	if mode != progress.ModeJSON {
+		return nil
+	}
+
+	out := os.Stdout
+	if progressFD == 1 {
+		os.Stdout = os.Stderr
+	} else {
+		out = os.NewFile(uintptr(progressFD), "progress-fd")
+		if out == nil {
+			return fmt.Errorf("invalid --progress-fd %d", progressFD)
+		}
+		if _, err := out.Stat(); err != nil {
+			return fmt.Errorf("--progress-fd %d is not open: %w", progressFD, err)
+		}
+	}
+
+	events = progress.NewEventWriter(out)
+	eventsOut = out
+	return nil
+}
+
+// archiveOutput is where the text and events of one archive go. An archive
+// of a batch extracted in the background writes to held buffers until it
+// becomes the foreground archive.
+type archiveOutput struct {
+	logger *logging.TextLogger
+	events *progress.EventWriter
+	held   []*heldWriter // Released in order by release
+}
+
+// foregroundOutput writes straight to the terminal, log file and event stream
+func foregroundOutput() *archiveOutput {
+	return &archiveOutput{logger: logger, events: events}
+}
+
+// backgroundOutput holds everything back until release
+func backgroundOutput() *archiveOutput {
+	out := &archiveOutput{}
+	hold := func(w io.Writer) io.Writer {
+		h := &heldWriter{w: w, holding: true}
+		out.held = append(out.held, h)
+		return h
+	}
+
+	out.logger = logging.NewLogger(hold(logOut), logLevel)
+	if logSink != nil {
+		out.logger.CopyTo(hold(logSink))
+	}
+	if events != nil {
+		out.events = progress.NewEventWriter(hold(eventsOut))
+	}
+	return out
+}
+
+// release writes what was held back and lets further output through
+func (o *archiveOutput) release() {
+	for _, h := range o.held {
+		h.release()
+	}
+}
+
+// background reports whether output is still held back
+func (o *archiveOutput) background() bool {
+	return len(o.held) > 0 && o.held[0].isHolding()
+}
+
+// newReporter builds the reporter for an extraction run. With --progress=json
+// the terminal reporter keeps printing text (to stderr) without progress
+// lines and the event stream is written alongside it. An archive in the
+// background gets no progress display, which would fight with the one in
+// front.
+func newReporter(out *archiveOutput) extractor.Reporter {
+	mode := progressMode
+	if out.events != nil || out.background() {
+		mode = progress.ModeNone
+	}
+	terminal := extractor.NewTerminalReporter(extractor.TerminalOptions{Logger: out.logger, Progress: mode, Stats: showStats})
+	if out.events == nil {
+		return terminal
+	}
+	return extractor.MultiReporter(terminal, extractor.NewJSONReporter(out.events))
+}
+
+// waitForEnter keeps the console window open when the tool was started by
+// drag and drop. Front-ends reading the event stream and -q runs never get
+// the prompt.
+func waitForEnter() {
+	if events != nil || quiet {
+		return
+	}
+	fmt.Println("Press Enter to exit...")
+	fmt.Scanln()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+// Exit codes returned by ntpi-dumper
+const (
+	ExitOK             = 0   // Success
+	ExitFailure        = 1   // Unclassified failure
+	ExitUsage          = 2   // Invalid arguments or missing input
+	ExitIO             = 3   // File could not be read or written
+	ExitInvalidArchive = 4   // Bad magic, truncated data or unsupported version
+	ExitDecrypt        = 5   // Key not found or decryption failed
+	ExitDecompress     = 6   // LZMA2 decompression failed or decoders disagreed
+	ExitHashMismatch   = 7   // Extracted data failed SHA256 verification
+	ExitNoSpace        = 8   // Preflight: not enough disk space or memory
+	ExitLocked         = 9   // Output directory is locked by another run
+	ExitInterrupted    = 130 // Interrupted by signal
+)
+
+// exitCodeHelp documents the exit codes in --help output
+const exitCodeHelp = `Exit codes:
+  0    success
+  1    unclassified failure
+  2    invalid arguments or missing input
+  3    I/O error
+  4    invalid or unsupported archive
+  5    key not found or decryption failed
+  6    decompression failed (or decoders disagreed under --cross-check)
+  7    hash mismatch
+  8    not enough disk space or memory
+  9    output directory locked by another run
+  130  interrupted`
+
+// exitCode maps an error to the exit code for its most specific cause. When
+// several files failed for different reasons, the first match in this order wins.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errBadTemplate):
+		return ExitUsage
+	case errors.Is(err, extractor.ErrHashMismatch):
+		return ExitHashMismatch
+	case errors.Is(err, extractor.ErrDecompress):
+		return ExitDecompress
+	case errors.Is(err, parser.ErrUnsupportedVersion):
+		// Wraps the decryption failure the default keys caused
+		return ExitInvalidArchive
+	case errors.Is(err, crypto.ErrDecrypt), errors.Is(err, crypto.ErrKeyNotFound):
+		return ExitDecrypt
+	case errors.Is(err, structures.ErrBadMagic), errors.Is(err, structures.ErrShortData):
+		return ExitInvalidArchive
+	case errors.Is(err, extractor.ErrInsufficientSpace), errors.Is(err, extractor.ErrInsufficientMemory):
+		return ExitNoSpace
+	case errors.Is(err, extractor.ErrOutputLocked):
+		return ExitLocked
+	case errors.Is(err, extractor.ErrIO), errors.As(err, &pathErr):
+		return ExitIO
+	default:
+		return ExitFailure
+	}
+}
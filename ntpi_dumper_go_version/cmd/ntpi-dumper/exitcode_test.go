@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+func TestExitCode(t *testing.T) {
+	decryptErr := fmt.Errorf("failed to extract region Metadata: %w", crypto.ErrDecrypt)
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, ExitOK},
+		{&parser.UnsupportedVersionError{Version: "9.9.0", Err: decryptErr}, ExitInvalidArchive},
+		{decryptErr, ExitDecrypt},
+		{fmt.Errorf("header: %w", structures.ErrShortData), ExitInvalidArchive},
+		{&extractor.HashMismatchError{Expected: "a", Actual: "b"}, ExitHashMismatch},
+		{fmt.Errorf("something else"), ExitFailure},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
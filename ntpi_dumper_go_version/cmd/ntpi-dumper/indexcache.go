@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+var (
+	indexCache   string
+	noIndexCache bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&indexCache, "index-cache", "", "Directory caching the block table of each archive, keeping the 64 most recently used (default: ntpi-dumper/index in the user cache directory)")
+	rootCmd.PersistentFlags().BoolVar(&noIndexCache, "no-index-cache", false, "Walk the NTENCODE headers every time instead of using the block index cache")
+}
+
+// indexCacheDir returns the block index cache directory, or "" when the
+// cache is disabled or there is no user cache directory
+func indexCacheDir() string {
+	if noIndexCache {
+		return ""
+	}
+	if indexCache != "" {
+		return indexCache
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ntpi-dumper", "index")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
+	"github.com/fatih/color"
+)
+
+var (
+	quiet   bool
+	verbose bool
+	debug   bool
+	logFile string
+
+	logger   *logging.TextLogger // Set by setupLogging
+	logOut   io.Writer           // Where logger writes
+	logLevel logging.Level       // Level of logger
+	logSink  *os.File            // --log-file, closed by closeLog
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print errors")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print per-block details (key index, IV and sizes of every block)")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Also dump the NTPI header and decrypted region headers (implies -v)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also write all output, without colors and including the -v and --debug details, to this file")
+}
+
+// setupLogging creates the logger for -q/-v/--debug and opens --log-file. It
+// must run after setupEvents, which may redirect stdout. The default progress
+// display is adjusted so it does not fight with the log output.
+func setupLogging() error {
+	if quiet && (verbose || debug) {
+		return errors.New("-q cannot be combined with -v or --debug")
+	}
+
+	level := logging.LevelInfo
+	switch {
+	case debug:
+		level = logging.LevelDebug
+	case verbose:
+		level = logging.LevelVerbose
+	case quiet:
+		level = logging.LevelError
+	}
+	logOut, logLevel = os.Stdout, level
+	logger = logging.NewLogger(logOut, logLevel)
+
+	if logFile != "" {
+		f, err := os.Create(logFile)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		logger.CopyTo(f)
+		logSink = f
+	}
+
+	if progressMode == progress.ModeAuto {
+		switch {
+		case quiet:
+			progressMode = progress.ModeNone
+		case level < logging.LevelInfo:
+			// Redrawn bars would tear the detail lines
+			progressMode = progress.ModePlain
+		}
+	}
+	return nil
+}
+
+// closeLog flushes and closes --log-file, if one is open
+func closeLog() {
+	if logSink == nil {
+		return
+	}
+	logSink.Sync()
+	logSink.Close()
+	logSink = nil
+}
+
+// fatalUsage prints err to stderr and exits with ExitUsage, for errors found
+// before the logger is set up
+func fatalUsage(err error) {
+	red := color.New(color.FgRed).SprintFunc()
+	fmt.Fprintf(os.Stderr, "%s %v\n", red("Error:"), err)
+	exit(ExitUsage)
+}
+
+// exit closes --log-file and exits with code. Commands use it instead of
+// os.Exit, which would skip the close.
+func exit(code int) {
+	closeLog()
+	os.Exit(code)
+}
@@ -4,11 +4,17 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
@@ -20,157 +26,417 @@ const (
 )
 
 var (
-	inputFile  string
-	outputDir  string
-	numWorkers int
-	keepTemp   bool
+	inputFile    string
+	outputDir    string
+	numWorkers   int
+	keepTemp     bool
+	tempRoot     string
+	dryRun       bool
+	maxMemory    string
+	decoderName  string
+	crossCheck   bool
+	showStats    bool
+	progressArg  string
+	progressFD   int
+	noColor      bool
+	segments     int
+	onlyParts    []string
+	excludeParts []string
+
+	maxMemoryBytes uint64                // Parsed from maxMemory
+	decoder        extractor.Decoder     // Parsed from decoderName
+	progressMode   progress.Mode         // Parsed from progressArg
+	events         *progress.EventWriter // Set for --progress=json
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "ntpi-dumper [file.ntpi]",
+	Use:   "ntpi-dumper [file.ntpi|directory|glob]...",
 	Short: Description,
 	Long: fmt.Sprintf(`%s v%s
 
 Extracts and decompresses firmware files from Nothing Phone NTPI archives.
-Features intelligent optimization for large files with multi-threaded segmentation.
+Decodes the blocks of all files through one shared pool sized to the CPU count.
+
+Several archives, directories of *.ntpi files and glob patterns may be given.
+Each is extracted into its own output directory, followed by a combined
+summary. While one archive is extracted, the next is parsed and feeds its
+blocks into the same pool; its output is shown once the first is done. A
+failed archive does not stop the rest unless --fail-fast is set, which also
+starts each archive only after the previous one succeeded.
+
+%s
 
-Author: %s`, Description, Version, Author),
-	Args: cobra.MaximumNArgs(1),
+Every flag can also be set with an NTPI_DUMPER_<FLAG> environment variable or
+in a config file; see "ntpi-dumper config --help".
+
+%s
+
+Author: %s`, Description, Version, outputTemplateHelp, exitCodeHelp, Author),
+	Args: cobra.ArbitraryArgs,
 	Run:  runExtraction,
 }
 
 func init() {
 	rootCmd.Flags().StringVarP(&inputFile, "file", "f", "", "Input NTPI file path")
-	rootCmd.Flags().StringVarP(&outputDir, "output", "o", "", "Output directory (default: <filename>_extracted)")
+	rootCmd.Flags().StringVarP(&outputDir, "output", "o", "", "Output directory; {name} and {dir} expand per input, and with several inputs a plain path is their parent (default: {dir}/{name}_extracted)")
 	rootCmd.Flags().IntVarP(&numWorkers, "workers", "w", 0, "Number of worker goroutines (default: auto)")
 	rootCmd.Flags().BoolVarP(&keepTemp, "keep-temp", "k", false, "Keep temporary files for debugging")
+	rootCmd.Flags().StringVar(&tempRoot, "temp-dir", "", "Parent directory for the per-run temp directory (default: system temp)")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Run Stage 1 and print the extraction plan without extracting")
+	rootCmd.Flags().StringVar(&decoderName, "decoder", "", "LZMA2 decoder: liblzma or go (default: liblzma when built with CGO)")
+	rootCmd.Flags().BoolVar(&crossCheck, "cross-check", false, "Decode every block with both liblzma and go and fail on any divergence")
+	rootCmd.Flags().BoolVar(&showStats, "stats", false, "Print per-phase timing and throughput (read, decrypt, decompress, hash, write)")
+	rootCmd.Flags().StringVar(&progressArg, "progress", "auto", "Progress display: auto, bar, plain (periodic lines for logs/CI), json (NDJSON events) or none")
+	rootCmd.Flags().IntVar(&progressFD, "progress-fd", 1, "File descriptor for --progress=json events (default: stdout)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also set by the NO_COLOR environment variable)")
+	rootCmd.Flags().IntVar(&segments, "segments", 0, "Most blocks of one partition decoded at once (default: the partition's share of the workers)")
+	rootCmd.Flags().StringSliceVar(&onlyParts, "only", nil, "Only extract partitions matching these patterns, e.g. \"boot*,vendor*\" (a pattern without / also matches base names)")
+	rootCmd.Flags().StringSliceVar(&excludeParts, "exclude", nil, "Skip partitions matching these patterns, e.g. userdata.img")
+	rootCmd.Flags().StringVar(&maxMemory, "max-memory", "", "Memory budget for in-flight decompressed data, e.g. 4GB (default: half of available memory)")
 	rootCmd.Version = Version
+	rootCmd.PersistentPreRun = setupCommand
+}
+
+// setupCommand runs before every command: flags not given on the command
+// line are taken from the environment or config file, then colors are set up
+func setupCommand(cmd *cobra.Command, args []string) {
+	_, err := applyConfig(cmd, cmd.Flags().Changed("config"))
+
+	// https://no-color.org: any non-empty NO_COLOR disables colors
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		color.NoColor = true
+	}
+
+	if err != nil {
+		fatalUsage(err)
+	}
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		exit(ExitUsage)
 	}
+	closeLog()
 }
 
 func runExtraction(cmd *cobra.Command, args []string) {
 	cyan := color.New(color.FgCyan).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
-	red := color.New(color.FgRed).SprintFunc()
 	yellow := color.New(color.FgYellow).SprintFunc()
 
+	// Set up the event stream first: it may move human-readable output to stderr
+	if err := setupEvents(); err != nil {
+		fatalUsage(fmt.Errorf("--progress: %w", err))
+	}
+	if err := setupLogging(); err != nil {
+		fatalUsage(err)
+	}
+
 	// Print banner (aligned)
-	fmt.Println(cyan("╔═══════════════════════════════════════════════════╗"))
-	fmt.Printf("%s %-49s %s\n", cyan("║"), green("  NTPI Dumper Go - High Performance Edition"), cyan("║"))
-	fmt.Printf("%s %-49s %s\n", cyan("║"), fmt.Sprintf("  Version %s", Version), cyan("║"))
-	fmt.Println(cyan("╚═══════════════════════════════════════════════════╝"))
-	fmt.Println()
+	logger.Infof("%s", cyan("╔═══════════════════════════════════════════════════╗"))
+	logger.Infof("%s %-49s %s", cyan("║"), green("  NTPI Dumper Go - High Performance Edition"), cyan("║"))
+	logger.Infof("%s %-49s %s", cyan("║"), fmt.Sprintf("  Version %s", Version), cyan("║"))
+	logger.Infof("%s", cyan("╚═══════════════════════════════════════════════════╝"))
+	logger.Infof("")
 
-	// Determine input file
-	if len(args) > 0 {
-		inputFile = args[0]
+	// Determine input files
+	if inputFile != "" {
+		args = append([]string{inputFile}, args...)
 	}
 
-	if inputFile == "" {
+	if len(args) == 0 {
 		fmt.Println(yellow("Usage: Drag and drop an NTPI file onto this executable, or use:"))
 		fmt.Println("  ntpi-dumper <file.ntpi>")
 		fmt.Println("  ntpi-dumper -f <file.ntpi> [-o output_dir] [-w workers]")
+		fmt.Println("  ntpi-dumper <file.ntpi|directory|glob>... [-o parent_dir] [--fail-fast]")
 		fmt.Println()
 		fmt.Println(green("Features: 3-5x faster than Python with goroutine-based parallelism"))
 		fmt.Println()
-		fmt.Println("Press Enter to exit...")
-		fmt.Scanln()
-		os.Exit(1)
+		waitForEnter()
+		exit(ExitUsage)
 	}
 
-	// Validate input file
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		fmt.Printf("%s Input file not found: %s\n", red("Error:"), inputFile)
-		fmt.Println("Press Enter to exit...")
-		fmt.Scanln()
-		os.Exit(1)
+	// Validate inputs
+	inputs, err := collectInputs(args)
+	if err != nil {
+		logger.Errorf("%v", err)
+		waitForEnter()
+		exit(ExitIO)
 	}
 
-	// Determine output directory
-	if outputDir == "" {
-		baseName := filepath.Base(inputFile)
-		ext := filepath.Ext(baseName)
-		nameWithoutExt := baseName[:len(baseName)-len(ext)]
-		outputDir = filepath.Join(filepath.Dir(inputFile), nameWithoutExt+"_extracted")
+	// Validate options before doing any work
+	if maxMemory != "" {
+		size, err := extractor.ParseSize(maxMemory)
+		if err != nil {
+			logger.Errorf("--max-memory: %v", err)
+			exit(ExitUsage)
+		}
+		maxMemoryBytes = size
+	}
+	selected, err := extractor.ParseDecoder(decoderName)
+	if err != nil {
+		logger.Errorf("--decoder: %v", err)
+		exit(ExitUsage)
+	}
+	decoder = selected
+	if segments < 0 {
+		logger.Errorf("--segments must not be negative")
+		exit(ExitUsage)
+	}
+	for _, pattern := range append(onlyParts, excludeParts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			logger.Errorf("invalid partition pattern %q: %v", pattern, err)
+			exit(ExitUsage)
+		}
+	}
+	if crossCheck && !extractor.LiblzmaAvailable {
+		logger.Errorf("--cross-check needs liblzma, but this binary was built without CGO")
+		exit(ExitUsage)
 	}
 
-	// Create temporary directory
-	tempDir := ".temp"
-	if err := os.RemoveAll(tempDir); err != nil {
-		fmt.Printf("%s Failed to clean temp directory: %v\n", red("Error:"), err)
+	// Determine output directories
+	outputs, err := outputDirs(inputs, outputDir, outputTemplate)
+	if err != nil {
+		logger.Errorf("%v", err)
+		waitForEnter()
+		exit(exitCode(err))
 	}
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		fmt.Printf("%s Failed to create temp directory: %v\n", red("Error:"), err)
-		fmt.Println("Press Enter to exit...")
-		fmt.Scanln()
-		os.Exit(1)
+
+	// All archives are decoded by one pool under one memory budget
+	opts := extractorOptions()
+	pool, err := extractor.NewPool(opts)
+	if err != nil {
+		logger.Errorf("%v", err)
+		exit(exitCode(err))
 	}
+	defer pool.Close()
+	opts.Pool = pool
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			logger.Warnf("Interrupted, cleaning up...")
+			// Remove the .partial files first: cleanup releases the output lock
+			extractor.AbortOutputs()
+			runCleanup()
+			exit(ExitInterrupted)
+		}
+	}()
 
 	// Start timing
 	totalStart := time.Now()
 
-	defer func() {
-		// Cleanup temporary files
-		if !keepTemp {
-			os.RemoveAll(tempDir)
-		} else {
-			absTemp, _ := filepath.Abs(tempDir)
-			fmt.Printf("%s\n", yellow(fmt.Sprintf("Temporary files kept in: %s", absTemp)))
+	if len(inputs) > 1 {
+		results := runBatch(inputs, outputs, opts)
+		code := printBatchSummary(results, time.Since(totalStart))
+		waitForEnter()
+		exit(code)
+	}
+
+	if err := runArchive(inputs[0], outputs[0], opts, foregroundOutput()); err != nil {
+		logger.Errorf("%v", err)
+		waitForEnter()
+		exit(exitCode(err))
+	}
+
+	if dryRun {
+		logger.Infof("\n%s", green("Dry run complete, nothing was extracted."))
+		return
+	}
+
+	// Print final summary
+	totalElapsed := time.Since(totalStart)
+	totalSeconds := totalElapsed.Seconds()
+	totalMinutes := totalElapsed.Minutes()
+
+	logger.Infof("")
+	logger.Infof("%s", green("╔═══════════════════════════════════════════════════╗"))
+	logger.Infof("%s %-49s %s", green("║"), cyan("  All files extracted successfully!"), green("║"))
+	logger.Infof("%s", green("╚═══════════════════════════════════════════════════╝"))
+	logger.Infof("")
+	logger.Infof("Output directory: %s", green(outputs[0]))
+	logger.Infof("Total time: %s (%.2f seconds / %.2f minutes)",
+		cyan(totalElapsed.Round(time.Second).String()), totalSeconds, totalMinutes)
+	logger.Infof("")
+	waitForEnter()
+}
+
+// extractorOptions collects the Stage 2 options from the command line
+func extractorOptions() extractor.Options {
+	return extractor.Options{
+		Workers:    numWorkers,
+		MaxMemory:  maxMemoryBytes,
+		Decoder:    decoder,
+		CrossCheck: crossCheck,
+		IndexCache: indexCacheDir(),
+		DryRun:     dryRun,
+		Segments:   segments,
+		Only:       onlyParts,
+		Exclude:    excludeParts,
+	}
+}
+
+var (
+	cleanupMu      sync.Mutex
+	activeCleanups = make(map[*sync.Once]func()) // Cleanups of the archives being extracted, for signals
+)
+
+// runCleanup runs the cleanups of the archives being extracted, if any
+func runCleanup() {
+	cleanupMu.Lock()
+	var cleanups []func()
+	for _, cleanup := range activeCleanups {
+		cleanups = append(cleanups, cleanup)
+	}
+	cleanupMu.Unlock()
+
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+}
+
+// runArchive extracts one archive into output using its own lock and temp
+// directory. Its text and events go to out.
+func runArchive(input, output string, opts extractor.Options, out *archiveOutput) error {
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	// Lock the output directory so concurrent runs cannot clobber each other.
+	// A dry run never writes to it, so it neither needs nor creates one.
+	var lock *extractor.OutputLock
+	if !dryRun {
+		var err error
+		lock, err = extractor.AcquireOutputLock(output)
+		if err != nil {
+			return err
 		}
+	}
+
+	// Create a private temporary directory for this run
+	tempDir, err := os.MkdirTemp(tempRoot, "ntpi-dumper-")
+	if err != nil {
+		lock.Release()
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	// Cleanup runs exactly once, whether we return, panic or get interrupted
+	var cleanupOnce sync.Once
+	cleanup := func() {
+		cleanupOnce.Do(func() {
+			if !keepTemp {
+				os.RemoveAll(tempDir)
+			} else {
+				absTemp, _ := filepath.Abs(tempDir)
+				out.logger.Infof("%s", yellow(fmt.Sprintf("Temporary files kept in: %s", absTemp)))
+			}
+			lock.Release()
+		})
+	}
+	cleanupMu.Lock()
+	activeCleanups[&cleanupOnce] = cleanup
+	cleanupMu.Unlock()
+	defer func() {
+		cleanupMu.Lock()
+		delete(activeCleanups, &cleanupOnce)
+		cleanupMu.Unlock()
+		cleanup()
 	}()
 
+	if stageErr := extract(input, output, tempDir, opts, out); stageErr != nil {
+		return stageErr
+	}
+	return nil
+}
+
+// stageError records which stage of the extraction failed
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.stage + " failed: " + e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// extract runs both extraction stages of input inside tempDir. Deferred
+// cleanup in the caller still runs if anything in here panics.
+func extract(input, output, tempDir string, opts extractor.Options, out *archiveOutput) *stageError {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	logger, events := out.logger, out.events
+
 	// Stage 1: Parse NTPI file and extract regions
-	fmt.Printf("Input file: %s\n", cyan(inputFile))
-	fmt.Printf("Output directory: %s\n", cyan(outputDir))
-	fmt.Println()
+	logger.Infof("Input file: %s", cyan(input))
+	logger.Infof("Output directory: %s", cyan(output))
+	logger.Infof("")
 
-	if err := parser.ParseNTPIFile(inputFile, tempDir); err != nil {
-		fmt.Printf("\n%s %v\n", red("Stage 1 Failed:"), err)
-		fmt.Println("Press Enter to exit...")
-		fmt.Scanln()
-		os.Exit(1)
+	// Stage 1 copies Region6 (almost the whole input) into the temp directory
+	if info, err := os.Stat(input); err == nil {
+		if err := extractor.CheckTempSpace(tempDir, uint64(info.Size())); err != nil {
+			return &stageError{stage: "Preflight", err: err}
+		}
+	}
+
+	stageStart := events.StageStart("stage1")
+	err := parser.ParseNTPIFile(input, tempDir, parser.Options{Reporter: newReporter(out)})
+	events.StageEnd("stage1", stageStart, err)
+	if err != nil {
+		return &stageError{stage: "Stage 1", err: err}
+	}
+
+	// Preflight: make sure Stage 2 fits before starting it. An archive parsed
+	// in the background may be in front by now, so it gets a new reporter
+	// that can show progress.
+	opts.Reporter = newReporter(out)
+	opts.Input = input
+	plan, err := extractor.BuildPlan(tempDir, output, opts)
+	if err != nil {
+		return &stageError{stage: "Preflight", err: err}
+	}
+	var planText strings.Builder
+	plan.Fprint(&planText)
+	logger.Infof("%s", planText.String())
+	if err := plan.Check(); err != nil {
+		return &stageError{stage: "Preflight", err: err}
+	}
+	if dryRun {
+		return nil
 	}
 
 	// Stage 2: Extract and decompress all files from Region6
-	if err := extractor.ExtractFiles(tempDir, outputDir, numWorkers); err != nil {
-		fmt.Printf("\n%s %v\n", red("Stage 2 Failed:"), err)
-		fmt.Println("Press Enter to exit...")
-		fmt.Scanln()
-		os.Exit(1)
+	stageStart = events.StageStart("stage2")
+	err = extractor.ExtractFiles(tempDir, output, opts)
+	events.StageEnd("stage2", stageStart, err)
+	if err != nil {
+		return &stageError{stage: "Stage 2", err: err}
 	}
 
-	// Move configuration XMLs to output directory
-	fmt.Printf("\n%s\n", cyan("Moving configuration files..."))
+	// Copy configuration XMLs to output directory
+	logger.Infof("\n%s", cyan("Copying configuration files..."))
 	for _, filename := range []string{"Patch.xml", "RawProgram.xml"} {
 		srcPath := filepath.Join(tempDir, filename)
-		destPath := filepath.Join(outputDir, filename)
+		destPath := filepath.Join(output, filename)
 		if _, err := os.Stat(srcPath); err == nil {
-			if err := os.Rename(srcPath, destPath); err != nil {
-				fmt.Printf("%s Failed to move %s: %v\n", red("Warning:"), filename, err)
+			if err := copyFile(srcPath, destPath); err != nil {
+				logger.Warnf("Failed to copy %s: %v", filename, err)
 			}
 		}
 	}
 
-	// Print final summary
-	totalElapsed := time.Since(totalStart)
-	totalSeconds := totalElapsed.Seconds()
-	totalMinutes := totalElapsed.Minutes()
+	return nil
+}
 
-	fmt.Println()
-	fmt.Println(green("╔═══════════════════════════════════════════════════╗"))
-	fmt.Printf("%s %-49s %s\n", green("║"), cyan("  All files extracted successfully!"), green("║"))
-	fmt.Println(green("╚═══════════════════════════════════════════════════╝"))
-	fmt.Println()
-	fmt.Printf("Output directory: %s\n", green(outputDir))
-	fmt.Printf("Total time: %s (%.2f seconds / %.2f minutes)\n",
-		cyan(totalElapsed.Round(time.Second).String()), totalSeconds, totalMinutes)
-	fmt.Println()
-	fmt.Println("Press Enter to exit...")
-	fmt.Scanln()
+// copyFile copies src to dst. The temp directory may live on a different
+// filesystem than the output, so a plain rename is not enough.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
 }
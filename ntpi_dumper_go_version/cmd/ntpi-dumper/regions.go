@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	regionsOutput  string
+	regionsRaw     bool
+	regionsHeaders bool
+)
+
+var regionsCmd = &cobra.Command{
+	Use:   "regions <file.ntpi>",
+	Short: "Decrypt the Stage 1 regions (Metadata, Patch, RawProgram, KeyMap, FileIndex) only",
+	Long: `Decrypts every region in the chain of an NTPI archive into a directory and
+skips Stage 2 entirely. The files are named as in Stage 1: Metadata.xml,
+Patch.xml, RawProgram.xml, KeyMap.bin and FileIndex.xml.
+
+Region6, which holds the encrypted partition images, is listed but not
+written; extract it with the main command.
+
+--raw also saves each region exactly as stored in the archive (<Region>.enc),
+and --headers writes the decrypted RegionBlockHeader of every region to
+regions.json and prints it.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runRegions,
+}
+
+func init() {
+	regionsCmd.Flags().StringVarP(&regionsOutput, "output", "o", "", "Output directory (default: <filename>_regions)")
+	regionsCmd.Flags().BoolVar(&regionsRaw, "raw", false, "Also save the encrypted region data as <Region>.enc")
+	regionsCmd.Flags().BoolVar(&regionsHeaders, "headers", false, "Print the RegionBlockHeader of every region and write regions.json")
+	rootCmd.AddCommand(regionsCmd)
+}
+
+// regionHeaderJSON is a RegionHeader in regions.json
+type regionHeaderJSON struct {
+	Type uint64 `json:"type"`
+	Size uint64 `json:"size"`
+}
+
+// regionJSON describes one region in regions.json
+type regionJSON struct {
+	Region  string            `json:"region"`
+	Type    uint64            `json:"type"`
+	Offset  int64             `json:"offset"`
+	Size    uint64            `json:"size"`
+	File    string            `json:"file,omitempty"`
+	RawFile string            `json:"raw_file,omitempty"`
+	This    *regionHeaderJSON `json:"this_header,omitempty"`
+	Next    *regionHeaderJSON `json:"next_header,omitempty"`
+	Real    uint64            `json:"real_size,omitempty"`
+}
+
+func runRegions(cmd *cobra.Command, args []string) {
+	if err := setupLogging(); err != nil {
+		fatalUsage(err)
+	}
+
+	input := args[0]
+	if _, err := os.Stat(input); err != nil {
+		logger.Errorf("Input file not found: %s", input)
+		exit(ExitIO)
+	}
+
+	output := regionsOutput
+	if output == "" {
+		baseName := filepath.Base(input)
+		output = filepath.Join(filepath.Dir(input), baseName[:len(baseName)-len(filepath.Ext(baseName))]+"_regions")
+	}
+
+	if err := dumpRegions(input, output); err != nil {
+		logger.Errorf("%v", err)
+		exit(exitCode(err))
+	}
+}
+
+// dumpRegions decrypts the regions of input into output
+func dumpRegions(input, output string) error {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	info, regions, err := parser.ReadRegions(input)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("%s", cyan("=== Regions ==="))
+	logger.Infof("Input file: %s", cyan(input))
+	logger.Infof("NTPI Version: %s", green(info.Version))
+	if !info.Supported {
+		logger.Warnf("Unsupported firmware version, using default keys")
+	}
+	logger.Infof("Output directory: %s", cyan(output))
+	logger.Infof("")
+
+	if err := os.MkdirAll(output, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var described []regionJSON
+	saved := 0
+	for _, region := range regions {
+		entry := regionJSON{Region: region.Name, Type: region.Type, Offset: region.Offset, Size: region.Size}
+
+		if region.Header == nil {
+			logger.Infof("%-12s offset %-10d %12d bytes  %s", region.Name, region.Offset, region.Size,
+				yellow("not extracted (partition images)"))
+			described = append(described, entry)
+			continue
+		}
+
+		entry.File = parser.RegionFileName(region.Type)
+		if err := os.WriteFile(filepath.Join(output, entry.File), region.Data, 0644); err != nil {
+			return fmt.Errorf("failed to save %s: %w", entry.File, err)
+		}
+		if regionsRaw {
+			entry.RawFile = region.Name + ".enc"
+			if err := os.WriteFile(filepath.Join(output, entry.RawFile), region.Encrypted, 0644); err != nil {
+				return fmt.Errorf("failed to save %s: %w", entry.RawFile, err)
+			}
+		}
+
+		header := region.Header
+		entry.This = &regionHeaderJSON{Type: header.ThisHeader.RegionType, Size: header.ThisHeader.RegionSize}
+		entry.Next = &regionHeaderJSON{Type: header.NextHeader.RegionType, Size: header.NextHeader.RegionSize}
+		entry.Real = header.RealSize
+		described = append(described, entry)
+		saved++
+
+		logger.Infof("%-12s offset %-10d %12d bytes  -> %s (%d bytes)", region.Name, region.Offset, region.Size,
+			green(entry.File), len(region.Data))
+		if regionsHeaders {
+			logger.Infof("             this=(type %d, size %d) next=(type %d, size %d) real_size=%d",
+				entry.This.Type, entry.This.Size, entry.Next.Type, entry.Next.Size, entry.Real)
+		}
+	}
+
+	if regionsHeaders {
+		data, err := json.MarshalIndent(described, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(output, "regions.json"), append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to save regions.json: %w", err)
+		}
+	}
+
+	logger.Infof("\n%s", green(fmt.Sprintf("Saved %d regions", saved)))
+	return nil
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var serveListen string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve <dir|file.ntpi|pattern>...",
+	Short: "Serve the partitions of NTPI archives over HTTP",
+	Long: `Serves every NTPI archive found in the given directories, files or glob
+patterns over HTTP. Partitions are decoded on demand, so clients only pay for
+the bytes they download:
+
+  GET /                               JSON list of archives
+  GET /fw/<name>/                     JSON description of an archive and its partitions
+  GET /fw/<name>/<partition>          partition data, with HTTP Range support; whole
+                                      downloads are aborted if the SHA256 does not match
+  GET /fw/<name>/Metadata.xml         Stage 1 XMLs (also Patch, RawProgram, FileIndex)
+  GET /verify/<name>[/<partition>]    decode and check the SHA256 of one or all partitions
+
+<name> is the archive's file name without extension. Directories are scanned
+again when the archive list is requested or an archive is not found, at most
+once every 10 seconds, so new firmware shows up without a restart.
+
+  ntpi-dumper serve --listen :8080 /srv/firmware
+  curl -r 0-511 http://box:8080/fw/firmware/super.img | xxd`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "localhost:8080", "Address to listen on, e.g. :8080 for all interfaces")
+	serveCmd.Flags().IntVarP(&numWorkers, "workers", "w", 0, "Number of blocks decoded ahead while streaming a whole partition (default: auto)")
+	serveCmd.Flags().StringVar(&decoderName, "decoder", "", "LZMA2 decoder: liblzma or go (default: liblzma when built with CGO)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	if err := setupLogging(); err != nil {
+		fatalUsage(err)
+	}
+
+	selected, err := extractor.ParseDecoder(decoderName)
+	if err != nil {
+		logger.Errorf("--decoder: %v", err)
+		exit(ExitUsage)
+	}
+
+	server := &archiveServer{
+		args: args,
+		opts: extractor.Options{
+			Workers:    numWorkers,
+			Decoder:    selected,
+			IndexCache: indexCacheDir(),
+			Reporter:   extractor.NewTerminalReporter(extractor.TerminalOptions{Logger: logger}),
+		},
+		archives: make(map[string]*servedArchive),
+		skipped:  make(map[string]bool),
+	}
+	if err := server.scan(); err != nil {
+		logger.Errorf("%v", err)
+		exit(ExitIO)
+	}
+	defer server.close()
+
+	listener, err := net.Listen("tcp", serveListen)
+	if err != nil {
+		logger.Errorf("%v", err)
+		exit(ExitIO)
+	}
+	logger.Infof("Serving %d archives on %s", len(server.archives), cyan("http://"+listener.Addr().String()))
+
+	httpServer := &http.Server{Handler: server.routes(), ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("%v", err)
+		exit(ExitIO)
+	}
+	logger.Infof("Server stopped")
+}
+
+// archiveServer serves the archives found in args. Archives are opened on
+// first use and stay open.
+type archiveServer struct {
+	args []string
+	opts extractor.Options
+
+	mu       sync.Mutex
+	archives map[string]*servedArchive // By name
+	skipped  map[string]bool           // Paths whose name was taken, warned about once
+	scanned  time.Time                 // Start of the last scan
+}
+
+// rescanInterval is the least time between two scans of the served directories
+const rescanInterval = 10 * time.Second
+
+// servedArchive is one archive known to the server
+type servedArchive struct {
+	name string
+	path string
+
+	mu      sync.Mutex         // Guards archive and fsys while opening
+	archive *extractor.Archive // nil until first opened
+	fsys    fs.FS
+}
+
+// archiveSummary is an entry of the archive list
+type archiveSummary struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+}
+
+// archiveDescription describes an opened archive
+type archiveDescription struct {
+	Name       string          `json:"name"`
+	File       string          `json:"file"`
+	Version    string          `json:"version"`
+	Supported  bool            `json:"supported"`
+	Partitions []partitionJSON `json:"partitions"`
+	Files      []string        `json:"files"`
+}
+
+// partitionJSON describes one partition of an archive
+type partitionJSON struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	URL    string `json:"url"`
+}
+
+// verifyResult is the outcome of verifying one partition
+type verifyResult struct {
+	Partition string `json:"partition"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+}
+
+// scan collects the archives in args, keeping those already known
+func (s *archiveServer) scan() error {
+	s.mu.Lock()
+	s.scanned = time.Now()
+	s.mu.Unlock()
+
+	inputs, err := collectInputs(s.args)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, input := range inputs {
+		base := filepath.Base(input)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		if known, ok := s.archives[name]; ok {
+			if known.path != input && !s.skipped[input] {
+				s.skipped[input] = true
+				logger.Warnf("Skipping %s: an archive named %s is already served from %s", input, name, known.path)
+			}
+			continue
+		}
+		s.archives[name] = &servedArchive{name: name, path: input}
+	}
+	return nil
+}
+
+// rescan scans again unless the last scan started less than rescanInterval
+// ago, so requests for unknown names cannot keep the server walking directories
+func (s *archiveServer) rescan() error {
+	s.mu.Lock()
+	due := time.Since(s.scanned) >= rescanInterval
+	if due {
+		// Claimed before scanning so concurrent requests do not scan as well
+		s.scanned = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+	return s.scan()
+}
+
+// close closes every opened archive
+func (s *archiveServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, served := range s.archives {
+		served.mu.Lock()
+		if served.archive != nil {
+			served.archive.Close()
+		}
+		served.mu.Unlock()
+	}
+}
+
+// open returns the archive called name, opening it on first use. Only the
+// archive's own lock is held while it is opened, so requests for other
+// archives are not held up; an open that failed is retried next time.
+func (s *archiveServer) open(name string) (*servedArchive, error) {
+	s.mu.Lock()
+	served, ok := s.archives[name]
+	s.mu.Unlock()
+	if !ok {
+		// It may have been added since the last scan
+		if err := s.rescan(); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		served, ok = s.archives[name]
+		s.mu.Unlock()
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+	}
+
+	served.mu.Lock()
+	defer served.mu.Unlock()
+	if served.archive == nil {
+		archive, err := extractor.OpenArchive(served.path, s.opts)
+		if err != nil {
+			return nil, err
+		}
+		served.archive = archive
+		served.fsys = archive.FS()
+	}
+	return served, nil
+}
+
+// routes returns the HTTP handler of the server
+func (s *archiveServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleList)
+	mux.HandleFunc("/fw/", s.handleArchive)
+	mux.HandleFunc("/verify/", s.handleVerify)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Verbosef("%s %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleList lists the archives
+func (s *archiveServer) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err := s.rescan(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	list := make([]archiveSummary, 0, len(s.archives))
+	for _, served := range s.archives {
+		entry := archiveSummary{Name: served.name, File: filepath.Base(served.path), URL: urlPath("fw", served.name) + "/"}
+		if info, err := os.Stat(served.path); err == nil {
+			entry.Size = info.Size()
+		}
+		list = append(list, entry)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleArchive serves /fw/<name>/ and the files below it
+func (s *archiveServer) handleArchive(w http.ResponseWriter, r *http.Request) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/fw/"), "/")
+	served, ok := s.lookup(w, name)
+	if !ok {
+		return
+	}
+
+	rest = strings.TrimSuffix(rest, "/")
+	if rest == "" {
+		writeJSON(w, http.StatusOK, describeArchive(served))
+		return
+	}
+
+	f, err := served.fsys.Open(rest)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	if dir, ok := f.(fs.ReadDirFile); ok && info.IsDir() {
+		entries, err := dir.ReadDir(-1)
+		if err != nil {
+			writeFSError(w, err)
+			return
+		}
+		listing := make([]partitionJSON, 0, len(entries))
+		for _, entry := range entries {
+			child := path.Join(rest, entry.Name())
+			item := partitionJSON{Name: child, URL: urlPath("fw", served.name, child)}
+			if entry.IsDir() {
+				item.URL += "/"
+			} else if entryInfo, err := entry.Info(); err == nil {
+				item.Size = uint64(entryInfo.Size())
+				if partition, ok := entryInfo.Sys().(*parser.FileInfo); ok {
+					item.SHA256 = strings.ToLower(partition.FileSha256Hash)
+				}
+			}
+			listing = append(listing, item)
+		}
+		writeJSON(w, http.StatusOK, listing)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "file is not seekable")
+		return
+	}
+	partition, isPartition := info.Sys().(*parser.FileInfo)
+	if isPartition && partition.FileSha256Hash != "" {
+		// Lets clients resume with If-Range
+		w.Header().Set("ETag", `"`+strings.ToLower(partition.FileSha256Hash)+`"`)
+	}
+	w.Header().Set("Content-Type", contentType(rest))
+	if isPartition && r.Method == http.MethodGet && !isPartialOrConditional(r) {
+		streamPartition(w, served, *partition, info.ModTime())
+		return
+	}
+	http.ServeContent(w, r, path.Base(rest), info.ModTime(), content)
+}
+
+// isPartialOrConditional reports whether a request needs http.ServeContent:
+// a Range or any precondition header
+func isPartialOrConditional(r *http.Request) bool {
+	for _, header := range []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if r.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamPartition sends a whole partition through Archive.Stream, which
+// decodes every block once, ahead of the writer, and checks the SHA256 at the
+// end. The response is chunked, so a failed check drops the connection before
+// the response completes and clients never take bad data for a good download.
+func streamPartition(w http.ResponseWriter, served *servedArchive, file parser.FileInfo, modTime time.Time) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if err := served.archive.Stream(w, file, 0, -1); err != nil {
+		logger.Warnf("%s: %s: %v", served.name, file.Name, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// handleVerify decodes one or all partitions of an archive and checks their hashes
+func (s *archiveServer) handleVerify(w http.ResponseWriter, r *http.Request) {
+	name, partition, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/verify/"), "/")
+	served, ok := s.lookup(w, name)
+	if !ok {
+		return
+	}
+
+	files := served.archive.Files
+	if partition = strings.TrimSuffix(partition, "/"); partition != "" {
+		file, ok := served.archive.Lookup(partition)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no partition %s in %s", partition, name))
+			return
+		}
+		files = []parser.FileInfo{file}
+	}
+
+	allOK := true
+	results := make([]verifyResult, 0, len(files))
+	for _, file := range files {
+		if err := r.Context().Err(); err != nil {
+			return
+		}
+		result := verifyResult{Partition: file.Name, OK: true}
+		if err := served.archive.Stream(io.Discard, file, 0, -1); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+			allOK = false
+			logger.Warnf("%s: %s: %v", name, file.Name, err)
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	if !allOK {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, struct {
+		Archive string         `json:"archive"`
+		OK      bool           `json:"ok"`
+		Results []verifyResult `json:"results"`
+	}{name, allOK, results})
+}
+
+// lookup opens the archive called name, writing an error response on failure
+func (s *archiveServer) lookup(w http.ResponseWriter, name string) (*servedArchive, bool) {
+	served, err := s.open(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no archive named %s", name))
+		return nil, false
+	case err != nil:
+		logger.Errorf("%s: %v", name, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return served, true
+}
+
+// describeArchive lists the partitions and Stage 1 files of an archive
+func describeArchive(served *servedArchive) archiveDescription {
+	archive := served.archive
+	description := archiveDescription{
+		Name:       served.name,
+		File:       filepath.Base(served.path),
+		Version:    archive.Info.Version,
+		Supported:  archive.Info.Supported,
+		Partitions: make([]partitionJSON, 0, len(archive.Files)),
+	}
+	for _, file := range archive.Files {
+		description.Partitions = append(description.Partitions, partitionJSON{
+			Name:   file.Name,
+			Size:   file.PartitionLength,
+			SHA256: strings.ToLower(file.FileSha256Hash),
+			URL:    urlPath("fw", served.name, file.Name),
+		})
+	}
+	if entries, err := fs.ReadDir(served.fsys, "."); err == nil {
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".xml") {
+				if info, err := entry.Info(); err == nil && info.Sys() == nil {
+					description.Files = append(description.Files, entry.Name())
+				}
+			}
+		}
+	}
+	return description
+}
+
+// urlPath joins path segments into an escaped absolute URL path
+func urlPath(segments ...string) string {
+	return (&url.URL{Path: "/" + path.Join(segments...)}).EscapedPath()
+}
+
+// contentType returns the Content-Type of a served file
+func contentType(name string) string {
+	if strings.HasSuffix(name, ".xml") {
+		return "application/xml"
+	}
+	return "application/octet-stream"
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeJSONError writes {"error": message}
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeFSError maps an error from the archive file system to a response
+func writeFSError(w http.ResponseWriter, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	logger.Errorf("%v", err)
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
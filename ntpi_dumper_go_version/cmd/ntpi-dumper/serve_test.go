@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/internal/ntpitest"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/extractor"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+)
+
+// newTestServer serves a directory holding good.ntpi and bad.ntpi, whose
+// vendor.img has a wrong hash
+func newTestServer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	_, ts, boot := newArchiveServer(t)
+	return ts, boot
+}
+
+// newArchiveServer is newTestServer that also returns the archiveServer
+func newArchiveServer(t *testing.T) (*archiveServer, *httptest.Server, []byte) {
+	t.Helper()
+	logger = logging.NewLogger(io.Discard, logging.LevelError)
+
+	boot := make([]byte, 3*ntpitest.BlockSize+500)
+	for i := range boot {
+		boot[i] = byte(i*31 ^ i>>9)
+	}
+	vendor := bytes.Repeat([]byte("vendor"), 1000)
+
+	dir := t.TempDir()
+	archives := map[string][]byte{
+		"good.ntpi": ntpitest.Build(
+			ntpitest.File{Name: "boot.img", Data: boot},
+			ntpitest.File{Name: "vendor.img", Data: vendor},
+		),
+		"bad.ntpi": ntpitest.Build(
+			ntpitest.File{Name: "boot.img", Data: boot},
+			ntpitest.File{Name: "vendor.img", Data: vendor, Hash: strings.Repeat("0", 64)},
+		),
+	}
+	for name, data := range archives {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := &archiveServer{
+		args:     []string{dir},
+		opts:     extractor.Options{Reporter: &extractor.Recorder{}},
+		archives: make(map[string]*servedArchive),
+		skipped:  make(map[string]bool),
+	}
+	if err := server.scan(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.close)
+
+	ts := httptest.NewServer(server.routes())
+	t.Cleanup(ts.Close)
+	return server, ts, boot
+}
+
+// get requests path with the given headers
+func get(t *testing.T, ts *httptest.Server, path string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestServeList(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	resp, body := get(t, ts, "/", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /: status %d: %s", resp.StatusCode, body)
+	}
+	var list []archiveSummary
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "bad" || list[1].Name != "good" {
+		t.Fatalf("GET /: got %+v, want bad and good", list)
+	}
+	if list[1].URL != "/fw/good/" || list[1].File != "good.ntpi" || list[1].Size == 0 {
+		t.Errorf("GET /: good entry %+v", list[1])
+	}
+}
+
+func TestServeRescanInterval(t *testing.T) {
+	server, ts, _ := newArchiveServer(t)
+	dir := server.args[0]
+	data := ntpitest.Build(ntpitest.File{Name: "boot.img", Data: []byte("new")})
+	if err := os.WriteFile(filepath.Join(dir, "new.ntpi"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown names do not trigger a scan until the interval has passed
+	for i := 0; i < 3; i++ {
+		if resp, _ := get(t, ts, "/fw/new/", nil); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("GET /fw/new/ right after a scan: status %d, want 404", resp.StatusCode)
+		}
+	}
+
+	server.mu.Lock()
+	server.scanned = server.scanned.Add(-rescanInterval)
+	server.mu.Unlock()
+	if resp, body := get(t, ts, "/fw/new/", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /fw/new/ after the interval: status %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestServeRange(t *testing.T) {
+	ts, boot := newTestServer(t)
+
+	// The range crosses a block boundary
+	first, last := ntpitest.BlockSize-100, ntpitest.BlockSize+99
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", first, last)
+	resp, body := get(t, ts, "/fw/good/boot.img", map[string]string{"Range": rangeHeader})
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Range: status %d, want 206", resp.StatusCode)
+	}
+	if want := fmt.Sprintf("bytes %d-%d/%d", first, last, len(boot)); resp.Header.Get("Content-Range") != want {
+		t.Errorf("Content-Range = %q, want %q", resp.Header.Get("Content-Range"), want)
+	}
+	if !bytes.Equal(body, boot[first:last+1]) {
+		t.Errorf("Range: body differs from the partition")
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	// A matching If-Range resumes, a stale one gets the whole partition
+	resp, body = get(t, ts, "/fw/good/boot.img", map[string]string{"Range": rangeHeader, "If-Range": etag})
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, boot[first:last+1]) {
+		t.Errorf("If-Range with the ETag: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	resp, body = get(t, ts, "/fw/good/boot.img", map[string]string{"Range": rangeHeader, "If-Range": `"stale"`})
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, boot) {
+		t.Errorf("If-Range with another ETag: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+}
+
+func TestServeFull(t *testing.T) {
+	ts, boot := newTestServer(t)
+
+	resp, body := get(t, ts, "/fw/good/boot.img", nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, boot) {
+		t.Fatalf("GET: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if resp.Header.Get("ETag") == "" || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("GET: headers %v", resp.Header)
+	}
+
+	// A partition failing its hash check must not look like a complete download
+	resp, err := ts.Client().Get(ts.URL + "/fw/bad/vendor.img")
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Error("GET of a partition with a wrong hash completed without error")
+	}
+}
+
+func TestServeVerify(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	type verifyResponse struct {
+		OK      bool           `json:"ok"`
+		Results []verifyResult `json:"results"`
+	}
+	tests := []struct {
+		path   string
+		status int
+		ok     bool
+	}{
+		{"/verify/good", http.StatusOK, true},
+		{"/verify/bad/boot.img", http.StatusOK, true},
+		{"/verify/bad", http.StatusUnprocessableEntity, false},
+		{"/verify/bad/vendor.img", http.StatusUnprocessableEntity, false},
+	}
+	for _, tt := range tests {
+		resp, body := get(t, ts, tt.path, nil)
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: status %d, want %d: %s", tt.path, resp.StatusCode, tt.status, body)
+			continue
+		}
+		var result verifyResponse
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		if result.OK != tt.ok {
+			t.Errorf("GET %s: ok = %v, want %v", tt.path, result.OK, tt.ok)
+		}
+		for _, r := range result.Results {
+			if !r.OK && r.Partition != "vendor.img" {
+				t.Errorf("GET %s: %s failed: %s", tt.path, r.Partition, r.Error)
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+var outputTemplate string
+
+// errBadTemplate is returned for templates that cannot produce valid outputs
+var errBadTemplate = errors.New("invalid output template")
+
+func init() {
+	rootCmd.Flags().StringVar(&outputTemplate, "output-template", "",
+		`Output directory layout under -o (or the current directory), e.g. "{device}/{version}/{build}"; see "Output templates" in --help`)
+}
+
+// outputTemplateHelp documents the placeholders in --help output
+const outputTemplateHelp = `Output templates:
+  -o and --output-template may contain placeholders:
+    {name}          input file name without extension
+    {dir}           directory of the input file
+    {ntpi_version}  version from the NTPI header
+    {sha256}        first 12 hex digits of the archive's SHA-256
+    {<field>}       any element or attribute of Metadata.xml, lower-case,
+                    e.g. {device} or {build}
+    {version}       Metadata.xml version, or the NTPI header version
+  Values are made safe for use as a single path component.`
+
+// placeholder matches {name} in an output template
+var placeholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// unsafePathChars are replaced in placeholder values
+var unsafePathChars = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]`)
+
+// expandTemplate replaces the placeholders of template for input. Metadata
+// and the archive hash are only read when the template uses them.
+func expandTemplate(template, input string) (string, error) {
+	baseName := filepath.Base(input)
+	values := map[string]string{
+		"name": strings.TrimSuffix(baseName, filepath.Ext(baseName)),
+		"dir":  filepath.Dir(input),
+	}
+
+	// Anything but a built-in placeholder or {sha256} comes from the metadata
+	needMetadata, needHash := false, false
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := values[match[1]]; ok {
+			continue
+		}
+		if match[1] == "sha256" {
+			needHash = true
+		} else {
+			needMetadata = true
+		}
+	}
+
+	if needMetadata {
+		metadata, err := parser.ReadMetadata(input)
+		if err != nil {
+			return "", fmt.Errorf("failed to read metadata of %s for the output template: %w", input, err)
+		}
+		// Built-in placeholders win over metadata fields of the same name
+		for key, value := range metadata.Fields {
+			if _, ok := values[key]; !ok {
+				values[key] = sanitizePathComponent(value)
+			}
+		}
+		values["ntpi_version"] = sanitizePathComponent(metadata.Version)
+		if _, ok := values["version"]; !ok {
+			values["version"] = values["ntpi_version"]
+		}
+	}
+
+	if needHash {
+		logger.Verbosef("Hashing %s for the output template...", input)
+		sum, err := hashFile(input)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", input, err)
+		}
+		values["sha256"] = sum[:12]
+	}
+
+	var unknown []string
+	expanded := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		key := match[1 : len(match)-1]
+		value, ok := values[key]
+		if !ok {
+			unknown = append(unknown, match)
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		keys := []string{"{sha256}"}
+		for key := range values {
+			if key != "sha256" {
+				keys = append(keys, "{"+key+"}")
+			}
+		}
+		sort.Strings(keys)
+		return "", fmt.Errorf("%w: unknown placeholder %s for %s (available: %s)",
+			errBadTemplate, strings.Join(unknown, ", "), input, strings.Join(keys, " "))
+	}
+
+	return filepath.Clean(expanded), nil
+}
+
+// sanitizePathComponent makes a metadata value usable as one directory name
+func sanitizePathComponent(value string) string {
+	value = unsafePathChars.ReplaceAllString(value, "_")
+	value = strings.Trim(value, " .")
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/internal/ntpitest"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	logger = logging.NewLogger(io.Discard, logging.LevelError)
+	archive := ntpitest.Write(t, ntpitest.File{Name: "boot.img", Data: []byte("boot")})
+	sum, err := hashFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not an archive: only templates that need its metadata fail
+	junk := filepath.Join(t.TempDir(), "junk.ntpi")
+	if err := os.WriteFile(junk, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	junkSum, err := hashFile(junk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		template, input, want string
+	}{
+		{"{dir}/{name}_extracted", archive, filepath.Join(filepath.Dir(archive), "test_extracted")},
+		{"out/{device}/{version}", archive, filepath.Join("out", "Testdevice", "1.0.0")},
+		{"{ntpi_version}", archive, "1.3.0"},
+		{"{name}-{sha256}", archive, "test-" + sum[:12]},
+		{"{name}-{sha256}", junk, "junk-" + junkSum[:12]},
+		{"{device}", junk, ""},
+		{"{nosuchfield}", archive, ""},
+	}
+	for _, tt := range tests {
+		got, err := expandTemplate(tt.template, tt.input)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("expandTemplate(%q, %s) = %q, want an error", tt.template, filepath.Base(tt.input), got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandTemplate(%q, %s) = %q, %v; want %q", tt.template, filepath.Base(tt.input), got, err, tt.want)
+		}
+	}
+
+	if _, err := expandTemplate("{nosuchfield}", archive); !errors.Is(err, errBadTemplate) {
+		t.Errorf("unknown placeholder: got %v, want errBadTemplate", err)
+	}
+}
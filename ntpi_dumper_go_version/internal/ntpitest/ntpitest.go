@@ -0,0 +1,191 @@
+// Package ntpitest - Synthetic NTPI archives for tests
+package ntpitest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// BlockSize is how much of a file each NTEncode block holds
+const BlockSize = 64 << 10
+
+// keyMapKeys is the number of 32-byte keys in the KeyMap
+const keyMapKeys = 16
+
+// Metadata is the Metadata.xml content of every archive
+const Metadata = `<?xml version="1.0"?><Metadata><Device>Testdevice</Device><Version>1.0.0</Version><Build>TEST-1.0.0-0001</Build></Metadata>`
+
+// File is one partition of a synthetic archive
+type File struct {
+	Name string
+	Data []byte
+	Hash string // FileSha256Hash to record instead of the real one, if set
+}
+
+// Write builds an archive of files in a temp directory of tb and returns its
+// path
+func Write(tb testing.TB, files ...File) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "test.ntpi")
+	if err := os.WriteFile(path, Build(files...), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// Build returns an NTPI 1.3.0 archive holding files. The regions are
+// encrypted with the 1.3.0 keys, and each file is split into LZMA2 blocks
+// encrypted with consecutive KeyMap keys. Build is deterministic.
+func Build(files ...File) []byte {
+	keyMap := make([]byte, 32*keyMapKeys)
+	for i := range keyMap {
+		keyMap[i] = byte(i*7 + 3)
+	}
+
+	var region6, fileIndex bytes.Buffer
+	fileIndex.WriteString("<fileinfo>\n")
+	keyIndex := 0
+	for _, file := range files {
+		offset := region6.Len()
+		first := keyIndex
+		// An empty file still has one (empty) block
+		for start := 0; start == 0 || start < len(file.Data); start += BlockSize {
+			end := min(start+BlockSize, len(file.Data))
+			region6.Write(encodeBlock(file.Data[start:end], keyAt(keyMap, keyIndex), keyIndex))
+			keyIndex++
+		}
+
+		hash := file.Hash
+		if hash == "" {
+			sum := sha256.Sum256(file.Data)
+			hash = hex.EncodeToString(sum[:])
+		}
+		fmt.Fprintf(&fileIndex, `  <file Name="%s" FileSha256Hash="%s" PartitionSha256Hash="" KeyIndex="%d" IsSparse="false" IsEncrypted="true" IsCompressed="true" PartitionLength="%d" OriginalLength="%d" Offset="%d" Length="%d"/>`+"\n",
+			file.Name, hash, first, len(file.Data), len(file.Data), offset, region6.Len()-offset)
+	}
+	fileIndex.WriteString("</fileinfo>\n")
+
+	contents := [][]byte{
+		[]byte(Metadata),
+		[]byte(`<patches/>`),
+		[]byte(`<data/>`),
+		keyMap,
+		fileIndex.Bytes(),
+	}
+
+	// Each region names the size of the next, so they are encrypted last first
+	keys := structures.AESDict_V1_3_0
+	encrypted := make([][]byte, len(contents))
+	nextType, nextSize := uint64(6), uint64(region6.Len())
+	for i := len(contents) - 1; i >= 0; i-- {
+		regionType := uint64(i + 1)
+		var plain bytes.Buffer
+		writeLE(&plain, structures.RegionBlockHeader{
+			ThisHeader: structures.RegionHeader{RegionType: regionType},
+			NextHeader: structures.RegionHeader{RegionType: nextType, RegionSize: nextSize},
+			RealSize:   uint64(len(contents[i])),
+		})
+		plain.Write(contents[i])
+		encrypted[i] = encryptCBC(decodeHex(keys.GetKeyForRegion(regionType)), decodeHex(keys.GetIVForRegion(regionType)), plain.Bytes())
+		nextType, nextSize = regionType, uint64(len(encrypted[i]))
+	}
+
+	var archive bytes.Buffer
+	writeLE(&archive, structures.NTPIHeader{
+		Magic:        [4]byte{'N', 'T', 'P', 'I'},
+		VersionMajor: 1,
+		VersionMinor: 3,
+		VersionPatch: 0,
+		FirstRegion:  structures.RegionHeader{RegionType: nextType, RegionSize: nextSize},
+	})
+	for _, region := range encrypted {
+		archive.Write(region)
+	}
+	archive.Write(region6.Bytes())
+	return archive.Bytes()
+}
+
+// encodeBlock compresses data and wraps it in an encrypted NTEncode block
+func encodeBlock(data, key []byte, keyIndex int) []byte {
+	var compressed bytes.Buffer
+	w, err := lzma.Writer2Config{DictCap: 1 << 20}.NewWriter2(&compressed)
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+
+	var plain bytes.Buffer
+	writeLE(&plain, structures.NTDecompressHeader{
+		Magic:         [8]byte{'N', 'T', 'E', 'N', 'C', 'O', 'D', 'E'},
+		PrimaryType:   2,
+		ProcessedSize: uint64(len(data)),
+		OriginalSize:  uint64(compressed.Len()),
+	})
+	plain.Write(compressed.Bytes())
+
+	header := structures.NTEncodeHeader{
+		Magic:         [8]byte{'N', 'T', 'E', 'N', 'C', 'O', 'D', 'E'},
+		PrimaryType:   1,
+		ProcessedSize: uint64(len(data)),
+		KeySize:       32,
+		IVSize:        16,
+	}
+	for i := 0; i < 16; i++ {
+		header.IV[i] = byte(keyIndex + i)
+	}
+	payload := encryptCBC(key, header.GetIV(), plain.Bytes())
+	header.OriginalSize = uint64(len(payload))
+
+	var block bytes.Buffer
+	writeLE(&block, header)
+	block.Write(payload)
+	return block.Bytes()
+}
+
+// keyAt returns the KeyMap key of keyIndex
+func keyAt(keyMap []byte, keyIndex int) []byte {
+	offset := keyIndex * 32 % len(keyMap)
+	return keyMap[offset : offset+32]
+}
+
+// encryptCBC pads data with PKCS7 and encrypts it with AES-CBC
+func encryptCBC(key, iv, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	out := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out
+}
+
+// decodeHex decodes a key or IV of the key dictionary
+func decodeHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// writeLE appends the little-endian encoding of a header
+func writeLE(buf *bytes.Buffer, v any) {
+	if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+		panic(err)
+	}
+}
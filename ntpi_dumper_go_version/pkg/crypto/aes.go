@@ -22,21 +22,21 @@ func DecryptAESCBC(encryptedData, key, iv []byte) ([]byte, error) {
 
 	// Validate key and IV sizes
 	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
-		return nil, fmt.Errorf("invalid key size: %d (must be 16, 24, or 32)", len(key))
+		return nil, fmt.Errorf("%w: invalid key size: %d (must be 16, 24, or 32)", ErrDecrypt, len(key))
 	}
 	if len(iv) != 16 {
-		return nil, fmt.Errorf("invalid IV size: %d (must be 16)", len(iv))
+		return nil, fmt.Errorf("%w: invalid IV size: %d (must be 16)", ErrDecrypt, len(iv))
 	}
 
 	// Validate encrypted data size (must be multiple of block size)
 	if len(encryptedData)%aes.BlockSize != 0 {
-		return nil, fmt.Errorf("encrypted data size is not a multiple of AES block size")
+		return nil, fmt.Errorf("%w: encrypted data size is not a multiple of AES block size", ErrDecrypt)
 	}
 
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, fmt.Errorf("%w: failed to create AES cipher: %v", ErrDecrypt, err)
 	}
 
 	// Create CBC decrypter
@@ -52,6 +52,27 @@ func DecryptAESCBC(encryptedData, key, iv []byte) ([]byte, error) {
 	return decryptedData, nil
 }
 
+// DecryptAESCBCInto decrypts encryptedData into dst using an already created
+// block cipher, without allocating. dst must be at least len(encryptedData)
+// bytes and may be encryptedData itself for in-place decryption. It returns
+// the decrypted data with any PKCS7 padding removed, as a slice of dst.
+func DecryptAESCBCInto(dst, encryptedData []byte, block cipher.Block, iv []byte) ([]byte, error) {
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid IV size: %d (must be 16)", ErrDecrypt, len(iv))
+	}
+	if len(encryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: encrypted data size is not a multiple of AES block size", ErrDecrypt)
+	}
+	if len(dst) < len(encryptedData) {
+		return nil, fmt.Errorf("%w: destination buffer too small: %d < %d", ErrDecrypt, len(dst), len(encryptedData))
+	}
+
+	dst = dst[:len(encryptedData)]
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(dst, encryptedData)
+
+	return removePKCS7Padding(dst), nil
+}
+
 // removePKCS7Padding removes PKCS7 padding from decrypted data
 func removePKCS7Padding(data []byte) []byte {
 	if len(data) == 0 {
@@ -83,7 +104,7 @@ func GetKeyIVForRegion(regionType uint64, keyDict *structures.AESKeyDict) ([]byt
 	ivHex := keyDict.GetIVForRegion(regionType)
 
 	if keyHex == "" || ivHex == "" {
-		return nil, nil, fmt.Errorf("key or IV not found for region %d", regionType)
+		return nil, nil, fmt.Errorf("%w: key or IV missing for region %d", ErrKeyNotFound, regionType)
 	}
 
 	// Decode hex strings to bytes
@@ -0,0 +1,57 @@
+// Package crypto - Per-key cipher cache for the block decryption hot loop
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+// CipherCache holds one AES cipher.Block per distinct KeyMap key, so block
+// decryption never has to copy a key or expand an AES key schedule
+type CipherCache struct {
+	keymapLen int
+	stride    int // Distance between distinct key offsets
+	blocks    []cipher.Block
+}
+
+// NewCipherCache expands every key reachable in keymapData up front
+func NewCipherCache(keymapData []byte) (*CipherCache, error) {
+	if len(keymapData) == 0 {
+		return nil, fmt.Errorf("%w: keymap data is empty", ErrKeyNotFound)
+	}
+
+	// Key offsets are (keyIndex*32) mod len(keymap), i.e. every multiple of
+	// gcd(32, len(keymap)) below len(keymap)
+	stride := gcd(32, len(keymapData))
+	cache := &CipherCache{
+		keymapLen: len(keymapData),
+		stride:    stride,
+		blocks:    make([]cipher.Block, len(keymapData)/stride),
+	}
+
+	key := make([]byte, 32)
+	for i := range cache.blocks {
+		copyKeyAtOffset(key, keymapData, i*stride)
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create AES cipher: %v", ErrDecrypt, err)
+		}
+		cache.blocks[i] = block
+	}
+
+	return cache, nil
+}
+
+// Cipher returns the cached cipher for a key index
+func (c *CipherCache) Cipher(keyIndex int) cipher.Block {
+	return c.blocks[keyMapOffset(c.keymapLen, keyIndex)/c.stride]
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
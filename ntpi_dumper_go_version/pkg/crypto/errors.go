@@ -0,0 +1,33 @@
+// Package crypto - Error types for key lookup and decryption
+package crypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrKeyNotFound is returned when no key is available for a region or block
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrDecrypt is returned when data cannot be decrypted
+	ErrDecrypt = errors.New("decryption failed")
+)
+
+// DecryptError reports a decryption failure at a specific Region6 offset
+type DecryptError struct {
+	Offset int // Offset of the NTEncode block within Region6
+	Err    error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("decryption failed at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrDecrypt) match any DecryptError
+func (e *DecryptError) Is(target error) bool {
+	return target == ErrDecrypt
+}
@@ -2,6 +2,7 @@
 package crypto
 
 import (
+	"crypto/cipher"
 	"fmt"
 
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
@@ -10,53 +11,63 @@ import (
 // ExtractKeyFromKeyMap extracts a 32-byte AES key from the keymap at the specified index
 // Each file block uses a different key, calculated by: key = keymap[keyIndex * 32 : keyIndex * 32 + 32]
 func ExtractKeyFromKeyMap(keymapData []byte, keyIndex int) ([]byte, error) {
-	if keymapData == nil || len(keymapData) == 0 {
-		return nil, fmt.Errorf("keymap data is empty")
+	key := make([]byte, 32)
+	if err := ExtractKeyFromKeyMapInto(key, keymapData, keyIndex); err != nil {
+		return nil, err
 	}
+	return key, nil
+}
 
-	// Calculate byte offset (32 bytes per key)
-	keyOffset := keyIndex * 32
-
-	// Wrap around if index exceeds keymap size
-	if keyOffset >= len(keymapData) {
-		keyOffset = keyOffset % len(keymapData)
+// ExtractKeyFromKeyMapInto is the allocation-free variant of ExtractKeyFromKeyMap.
+// It copies the key into dst, which must be at least 32 bytes.
+func ExtractKeyFromKeyMapInto(dst, keymapData []byte, keyIndex int) error {
+	if len(keymapData) == 0 {
+		return fmt.Errorf("%w: keymap data is empty", ErrKeyNotFound)
 	}
-
-	// Ensure we don't read past the end
-	if keyOffset+32 > len(keymapData) {
-		// Wrap around and concatenate
-		firstPart := keymapData[keyOffset:]
-		remaining := 32 - len(firstPart)
-		secondPart := keymapData[:remaining]
-		key := make([]byte, 32)
-		copy(key, firstPart)
-		copy(key[len(firstPart):], secondPart)
-		return key, nil
+	if len(dst) < 32 {
+		return fmt.Errorf("key buffer too small: %d bytes", len(dst))
 	}
 
-	// Extract 32-byte key
-	key := make([]byte, 32)
-	copy(key, keymapData[keyOffset:keyOffset+32])
+	// Calculate byte offset (32 bytes per key), wrapping around the keymap
+	copyKeyAtOffset(dst, keymapData, keyMapOffset(len(keymapData), keyIndex))
 
-	return key, nil
+	return nil
+}
+
+// copyKeyAtOffset copies the 32-byte key starting at offset into dst.
+// A key that runs past the end of the keymap wraps around to the start.
+func copyKeyAtOffset(dst, keymapData []byte, offset int) {
+	n := copy(dst[:32], keymapData[offset:])
+	for n < 32 {
+		n += copy(dst[n:32], keymapData)
+	}
+}
+
+// keyMapOffset returns the byte offset of a key, wrapping around the keymap
+func keyMapOffset(keymapLen, keyIndex int) int {
+	keyOffset := keyIndex * 32
+	if keyOffset >= keymapLen {
+		keyOffset = keyOffset % keymapLen
+	}
+	return keyOffset
 }
 
 // DecryptNTEncodeBlock decrypts a single NTEncode block from Region6 data
 func DecryptNTEncodeBlock(region6Data []byte, offset int, key []byte) (int, []byte, error) {
 	// Validate offset
 	if offset >= len(region6Data) {
-		return 0, nil, fmt.Errorf("offset %d exceeds data size %d", offset, len(region6Data))
+		return 0, nil, &DecryptError{Offset: offset, Err: fmt.Errorf("offset exceeds data size %d", len(region6Data))}
 	}
 
 	// Parse NTEncode header
 	headerSize := 112
 	if offset+headerSize > len(region6Data) {
-		return 0, nil, fmt.Errorf("not enough data for NTEncode header at offset %d", offset)
+		return 0, nil, &DecryptError{Offset: offset, Err: fmt.Errorf("not enough data for NTEncode header")}
 	}
 
 	header, err := structures.ParseNTEncodeHeader(region6Data[offset : offset+headerSize])
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to parse NTEncode header: %w", err)
+		return 0, nil, &DecryptError{Offset: offset, Err: fmt.Errorf("failed to parse NTEncode header: %w", err)}
 	}
 
 	// Extract encrypted data
@@ -64,18 +75,14 @@ func DecryptNTEncodeBlock(region6Data []byte, offset int, key []byte) (int, []by
 	encryptedSize := int(header.OriginalSize)
 
 	if dataOffset+encryptedSize > len(region6Data) {
-		return 0, nil, fmt.Errorf("encrypted data exceeds region6 bounds")
+		return 0, nil, &DecryptError{Offset: offset, Err: fmt.Errorf("encrypted data exceeds region6 bounds")}
 	}
 
 	encryptedData := region6Data[dataOffset : dataOffset+encryptedSize]
 
-	// Get IV from header (first 16 bytes)
-	iv := header.GetIV()
-
-	// Decrypt using AES-CBC
-	decryptedData, err := DecryptAESCBC(encryptedData, key, iv)
+	decryptedData, err := DecryptNTEncodePayload(header, encryptedData, key)
 	if err != nil {
-		return 0, nil, fmt.Errorf("AES decryption failed: %w", err)
+		return 0, nil, &DecryptError{Offset: offset, Err: err}
 	}
 
 	// Calculate next block offset
@@ -83,3 +90,24 @@ func DecryptNTEncodeBlock(region6Data []byte, offset int, key []byte) (int, []by
 
 	return nextOffset, decryptedData, nil
 }
+
+// DecryptNTEncodePayloadInto is the allocation-free variant of DecryptNTEncodePayload.
+// It decrypts into dst (which may be encryptedData itself) with a cached cipher.
+func DecryptNTEncodePayloadInto(dst []byte, header *structures.NTEncodeHeader, encryptedData []byte, block cipher.Block) ([]byte, error) {
+	if len(encryptedData) != int(header.OriginalSize) {
+		return nil, fmt.Errorf("%w: payload is %d bytes, header says %d", ErrDecrypt, len(encryptedData), header.OriginalSize)
+	}
+
+	return DecryptAESCBCInto(dst, encryptedData, block, header.GetIV())
+}
+
+// DecryptNTEncodePayload decrypts the data that follows an already parsed NTEncode header.
+// Callers that read blocks themselves use this instead of DecryptNTEncodeBlock.
+func DecryptNTEncodePayload(header *structures.NTEncodeHeader, encryptedData, key []byte) ([]byte, error) {
+	if len(encryptedData) != int(header.OriginalSize) {
+		return nil, fmt.Errorf("%w: payload is %d bytes, header says %d", ErrDecrypt, len(encryptedData), header.OriginalSize)
+	}
+
+	// Get IV from header (first 16 bytes) and decrypt using AES-CBC
+	return DecryptAESCBC(encryptedData, key, header.GetIV())
+}
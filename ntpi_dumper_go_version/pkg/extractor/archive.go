@@ -0,0 +1,229 @@
+// Package extractor - Direct access to the partitions of an archive
+package extractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+// Archive reads partitions straight from an NTPI file. The small regions are
+// decrypted in memory and blocks are read from Region6 in place, so nothing
+// is written to a temp directory.
+type Archive struct {
+	Info  *parser.ArchiveInfo
+	Files []parser.FileInfo
+
+	file    *os.File
+	modTime time.Time
+	xmls    map[string][]byte // Decrypted Stage 1 XMLs by file name
+	source  *archiveSource
+	decode  decodeFunc
+	workers int
+	cache   *blockCache // Decoded blocks shared by partition readers
+}
+
+// OpenArchive decrypts the regions of an NTPI file and prepares its
+// partitions for reading. The Workers, Decoder, CrossCheck and IndexCache
+// options apply.
+func OpenArchive(path string, opts Options) (*Archive, error) {
+	decode, err := newDecodeFunc(opts.Decoder, opts.CrossCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	info, regions, err := parser.ReadRegions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyMap, fileIndex []byte
+	var region6 *parser.Region
+	xmls := make(map[string][]byte)
+	for i := range regions {
+		switch regions[i].Name {
+		case "KeyMap":
+			keyMap = regions[i].Data
+		case "Region6":
+			region6 = &regions[i]
+		default:
+			if regions[i].Name == "FileIndex" {
+				fileIndex = regions[i].Data
+			}
+			xmls[parser.RegionFileName(regions[i].Type)] = regions[i].Data
+		}
+	}
+	if keyMap == nil || fileIndex == nil || region6 == nil {
+		return nil, fmt.Errorf("%w: archive lacks KeyMap, FileIndex or Region6", structures.ErrShortData)
+	}
+
+	files, err := parser.ParseFileIndexData(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand every key once instead of per block
+	ciphers, err := crypto.NewCipherCache(keyMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KeyMap: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NTPI file: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read NTPI file: %w", err)
+	}
+
+	return &Archive{
+		Info:    info,
+		Files:   files,
+		file:    f,
+		modTime: stat.ModTime(),
+		xmls:    xmls,
+		source: &archiveSource{
+			region6:  io.NewSectionReader(f, region6.Offset, int64(region6.Size)),
+			ciphers:  ciphers,
+			index:    openArchiveIndex(opts.IndexCache, path, opts.reporter()),
+			reporter: opts.reporter(),
+		},
+		decode:  decode,
+		workers: resolveWorkers(opts.Workers),
+		cache:   newBlockCache(blockCacheSize),
+	}, nil
+}
+
+// Close closes the underlying NTPI file
+func (a *Archive) Close() error {
+	return a.file.Close()
+}
+
+// Lookup returns the FileIndex entry of the partition called name
+func (a *Archive) Lookup(name string) (parser.FileInfo, bool) {
+	for _, file := range a.Files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return parser.FileInfo{}, false
+}
+
+// index returns the block index of a partition, walking its NTENCODE headers
+// only if the cache has no index for it yet. The sidecar is only rewritten
+// after such a walk.
+func (a *Archive) index(file parser.FileInfo) (*blockIndex, error) {
+	index, walked, err := a.source.index.lookup(a.source.region6, file)
+	if err != nil {
+		return nil, err
+	}
+	if walked {
+		a.source.index.save()
+	}
+	return index, nil
+}
+
+// Stream decodes a partition and writes its bytes in order to w. Only the
+// blocks covering offset..offset+length are decoded; a negative length means
+// up to the end. When the whole partition is written its SHA256 is verified
+// at the end, after all data has already gone to w.
+func (a *Archive) Stream(w io.Writer, file parser.FileInfo, offset, length int64) (err error) {
+	index, err := a.index(file)
+	if err != nil {
+		return err
+	}
+
+	size := index.size
+	if offset < 0 || offset > size {
+		return fmt.Errorf("offset %d is outside %s (%d bytes)", offset, file.Name, size)
+	}
+	if length < 0 || length > size-offset {
+		length = size - offset
+	}
+	end := offset + length
+
+	if offset == 0 && end == size {
+		h := sha256.New()
+		w = io.MultiWriter(w, h)
+		defer func() {
+			if err != nil {
+				return
+			}
+			actualHash := hex.EncodeToString(h.Sum(nil))
+			if !strings.EqualFold(actualHash, file.FileSha256Hash) {
+				err = &HashMismatchError{Expected: file.FileSha256Hash, Actual: actualHash}
+			}
+		}()
+	}
+
+	// Only the blocks overlapping the range are decoded
+	var blocks []blockRef
+	if end > offset {
+		blocks = index.blocks[index.find(offset) : index.find(end-1)+1]
+	}
+	return a.writeBlocks(w, file, blocks, offset, end)
+}
+
+// writeBlocks decodes blocks ahead of the writer on up to a.workers
+// goroutines and writes the part of each that falls inside offset..end.
+// A block's slot is only freed once it has been written, which bounds memory
+// to a.workers decoded blocks.
+func (a *Archive) writeBlocks(w io.Writer, file parser.FileInfo, blocks []blockRef, offset, end int64) error {
+	job := &fileJob{archive: a.source, info: file}
+	results := make([]chan blockResult, len(blocks))
+	for i := range results {
+		results[i] = make(chan blockResult, 1)
+	}
+	slots := make(chan struct{}, a.workers)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for i, block := range blocks {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, block blockRef) {
+				data, err := decodeIndexedBlock(blockJob{file: job, block: block}, a.decode)
+				results[i] <- blockResult{index: block.Index, data: data, err: err}
+			}(i, block)
+		}
+	}()
+
+	for i, result := range results {
+		r := <-result
+		if r.err != nil {
+			putBuffer(r.data)
+			return r.err
+		}
+
+		// Trim the first and last block to the requested range
+		data := r.data
+		if lo := offset - blocks[i].Start; lo > 0 {
+			data = data[lo:]
+		}
+		if over := blocks[i].Start + int64(len(r.data)) - end; over > 0 {
+			data = data[:int64(len(data))-over]
+		}
+
+		_, err := w.Write(data)
+		putBuffer(r.data)
+		<-slots
+		if err != nil {
+			return &IOError{Op: "write", Path: file.Name, Err: err}
+		}
+	}
+	return nil
+}
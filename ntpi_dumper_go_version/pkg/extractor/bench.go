@@ -0,0 +1,372 @@
+// Package extractor - Crypto and decompression throughput benchmark
+package extractor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/fatih/color"
+)
+
+const (
+	// defaultBenchSamples is the number of Region6 blocks sampled by default
+	defaultBenchSamples = 16
+	// defaultBenchTime is the minimum duration of each measurement
+	defaultBenchTime = time.Second
+)
+
+// BenchOptions configures Benchmark
+type BenchOptions struct {
+	Samples int           // Blocks sampled from Region6 (0 = 16)
+	Workers int           // Goroutines for multi-core runs (0 = one per CPU)
+	MinTime time.Duration // Minimum duration of each measurement (0 = 1s)
+}
+
+// BenchResult is the throughput of one operation in bytes per second
+type BenchResult struct {
+	Name   string
+	Single float64 // One goroutine
+	Multi  float64 // BenchReport.Workers goroutines
+}
+
+// Speedup returns the multi-core speedup over a single core
+func (r *BenchResult) Speedup() float64 {
+	if r.Single == 0 {
+		return 0
+	}
+	return r.Multi / r.Single
+}
+
+// ScalingPoint is the full block pipeline throughput with a given worker count
+type ScalingPoint struct {
+	Workers    int
+	Throughput float64 // Decompressed bytes per second
+}
+
+// BenchReport holds the benchmark results and the recommended configuration
+type BenchReport struct {
+	Blocks         int    // Blocks in the sample
+	EncryptedSize  uint64 // Encrypted bytes in the sample
+	ProcessedSize  uint64 // Decompressed bytes in the sample
+	Workers        int
+	Results        []BenchResult
+	Decoder        Decoder        // Decoder used for the scaling runs (the fastest)
+	Scaling        []ScalingPoint // Pipeline throughput per worker count
+	TotalSize      uint64         // Decompressed size of the whole archive
+	LargestFile    string
+	LargestSize    uint64
+	RecWorkers     int           // Recommended worker count
+	RecSegments    int           // Segments the largest file starts with at RecWorkers
+	EstimatedStage time.Duration // Estimated Stage 2 time at RecWorkers (CPU only)
+}
+
+// benchBlock is one sampled block held in memory, so the benchmark measures
+// CPU throughput rather than disk speed
+type benchBlock struct {
+	ref        blockRef
+	encrypted  []byte
+	compressed []byte // Raw LZMA2 stream after the NTDecompress header
+	output     []byte // Decompressed data
+}
+
+// Benchmark samples blocks from the Stage 1 results in tempDir and measures
+// decryption, every available LZMA2 decoder and SHA-256, single- and
+// multi-core, then the whole block pipeline at increasing worker counts
+func Benchmark(tempDir string, opts BenchOptions) (*BenchReport, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = defaultBenchSamples
+	}
+	if opts.MinTime <= 0 {
+		opts.MinTime = defaultBenchTime
+	}
+
+	files, err := parser.ParseFileIndex(filepath.Join(tempDir, "FileIndex.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FileIndex.xml: %w", err)
+	}
+
+	region6File, err := os.Open(filepath.Join(tempDir, "region6block.bin"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Region6 data: %w", err)
+	}
+	defer region6File.Close()
+
+	keyMapData, err := os.ReadFile(filepath.Join(tempDir, "KeyMap.bin"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KeyMap: %w", err)
+	}
+	ciphers, err := crypto.NewCipherCache(keyMapData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KeyMap: %w", err)
+	}
+
+	report := &BenchReport{Workers: resolveWorkers(opts.Workers)}
+
+	// Walk the blocks of every file, as extraction does
+	var all []blockRef
+	for _, file := range files {
+		blocks, err := scanBlocks(region6File, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to enumerate blocks: %w", file.Name, err)
+		}
+		all = append(all, blocks...)
+
+		report.TotalSize += file.PartitionLength
+		if file.PartitionLength >= report.LargestSize {
+			report.LargestFile = file.Name
+			report.LargestSize = file.PartitionLength
+		}
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("archive has no blocks to benchmark")
+	}
+
+	samples, err := loadBenchSamples(region6File, ciphers, all, opts.Samples)
+	if err != nil {
+		return nil, err
+	}
+	report.Blocks = len(samples)
+	for _, s := range samples {
+		report.EncryptedSize += uint64(len(s.encrypted))
+		report.ProcessedSize += uint64(len(s.output))
+	}
+
+	// Per-worker scratch buffers sized for the largest sampled block
+	maxEncrypted, maxOutput := 0, 0
+	for _, s := range samples {
+		maxEncrypted = max(maxEncrypted, len(s.encrypted))
+		maxOutput = max(maxOutput, len(s.output))
+	}
+	scratch := func(size int) [][]byte {
+		bufs := make([][]byte, report.Workers)
+		for i := range bufs {
+			bufs[i] = make([]byte, size)
+		}
+		return bufs
+	}
+	decryptBufs := scratch(maxEncrypted)
+	outputBufs := scratch(maxOutput)
+
+	run := func(name string, op func(worker int, s *benchBlock) (int, error)) error {
+		result := BenchResult{Name: name}
+		var err error
+		if result.Single, err = measure(1, samples, opts.MinTime, op); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if result.Multi, err = measure(report.Workers, samples, opts.MinTime, op); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		report.Results = append(report.Results, result)
+		return nil
+	}
+
+	// AES-256-CBC with the cached per-key cipher, as the pipeline decrypts
+	err = run("AES-CBC decrypt", func(worker int, s *benchBlock) (int, error) {
+		_, err := crypto.DecryptAESCBCInto(decryptBufs[worker], s.encrypted, ciphers.Cipher(s.ref.KeyIndex), s.ref.Header.GetIV())
+		return len(s.encrypted), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every decoder built into this binary; the fastest drives the scaling runs
+	decoders := []Decoder{DecoderGo}
+	if LiblzmaAvailable {
+		decoders = []Decoder{DecoderLiblzma, DecoderGo}
+	}
+	bestDecoder := 0.0
+	for _, decoder := range decoders {
+		decode, err := newDecodeFunc(decoder, false)
+		if err != nil {
+			return nil, err
+		}
+		err = run("LZMA2 "+string(decoder), func(worker int, s *benchBlock) (int, error) {
+			out := outputBufs[worker][:len(s.output)]
+			return len(out), decode(s.compressed, out, lzma2DictSize(uint64(len(out))))
+		})
+		if err != nil {
+			return nil, err
+		}
+		if single := report.Results[len(report.Results)-1].Single; single > bestDecoder {
+			bestDecoder = single
+			report.Decoder = decoder
+		}
+	}
+
+	err = run("SHA-256", func(worker int, s *benchBlock) (int, error) {
+		sha256.Sum256(s.output)
+		return len(s.output), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Whole pipeline (decrypt, decompress, hash) at increasing worker counts
+	decode, err := newDecodeFunc(report.Decoder, false)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := func(worker int, s *benchBlock) (int, error) {
+		decrypted, err := crypto.DecryptAESCBCInto(decryptBufs[worker], s.encrypted, ciphers.Cipher(s.ref.KeyIndex), s.ref.Header.GetIV())
+		if err != nil {
+			return 0, err
+		}
+		data, err := decompressLZMA2(decrypted, decode)
+		if err != nil {
+			return 0, err
+		}
+		sha256.Sum256(data)
+		putBuffer(data)
+		return len(data), nil
+	}
+
+	best := 0.0
+	for _, n := range scalingSteps(report.Workers) {
+		throughput, err := measure(n, samples, opts.MinTime, pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: %w", err)
+		}
+		report.Scaling = append(report.Scaling, ScalingPoint{Workers: n, Throughput: throughput})
+		best = max(best, throughput)
+	}
+
+	// Recommend the fewest workers that get within 5% of the best throughput
+	for _, point := range report.Scaling {
+		if point.Throughput >= 0.95*best {
+			report.RecWorkers = point.Workers
+			if point.Throughput > 0 {
+				report.EstimatedStage = time.Duration(float64(report.TotalSize) / point.Throughput * float64(time.Second))
+			}
+			break
+		}
+	}
+	report.RecSegments = segmentLimit(report.RecWorkers, 0, report.LargestSize, report.TotalSize)
+
+	return report, nil
+}
+
+// loadBenchSamples reads, decrypts and decompresses n blocks spread evenly
+// over all blocks, so the same archive always yields the same sample
+func loadBenchSamples(region6 *os.File, ciphers *crypto.CipherCache, all []blockRef, n int) ([]*benchBlock, error) {
+	n = min(n, len(all))
+	decode, err := newDecodeFunc(DecoderAuto, false)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]*benchBlock, 0, n)
+	for i := 0; i < n; i++ {
+		ref := all[i*len(all)/n]
+
+		encrypted := make([]byte, ref.EncryptedSize())
+		if _, err := region6.ReadAt(encrypted, ref.Offset+ntEncodeHeaderSize); err != nil {
+			return nil, &IOError{Op: "read block from", Path: "Region6", Err: err}
+		}
+
+		decrypted, err := crypto.DecryptNTEncodePayloadInto(make([]byte, len(encrypted)), &ref.Header, encrypted, ciphers.Cipher(ref.KeyIndex))
+		if err != nil {
+			return nil, fmt.Errorf("block %d at offset %d: %w", ref.Index, ref.Offset, err)
+		}
+		output, err := decompressLZMA2(decrypted, decode)
+		if err != nil {
+			return nil, &DecompressError{Block: ref.Index, Err: err}
+		}
+
+		samples = append(samples, &benchBlock{
+			ref:        ref,
+			encrypted:  encrypted,
+			compressed: decrypted[ntDecompressHeaderSize:],
+			output:     append([]byte(nil), output...),
+		})
+		putBuffer(output)
+	}
+
+	return samples, nil
+}
+
+// measure runs op over the sample with n goroutines, repeating whole passes
+// until minTime has elapsed, and returns bytes processed per second. Each
+// pass hands every goroutine the equivalent of one full sample.
+func measure(n int, samples []*benchBlock, minTime time.Duration, op func(worker int, s *benchBlock) (int, error)) (float64, error) {
+	var total int64
+	var firstErr error
+	var errOnce sync.Once
+
+	start := time.Now()
+	for time.Since(start) < minTime {
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		tasks := int64(len(samples) * n)
+
+		for w := 0; w < n; w++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for i := next.Add(1) - 1; i < tasks; i = next.Add(1) - 1 {
+					bytes, err := op(worker, samples[i%int64(len(samples))])
+					if err != nil {
+						errOnce.Do(func() { firstErr = err })
+						return
+					}
+					atomic.AddInt64(&total, int64(bytes))
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return 0, firstErr
+		}
+	}
+
+	return float64(total) / time.Since(start).Seconds(), nil
+}
+
+// scalingSteps returns 1, 2, 4, ... up to and including workers
+func scalingSteps(workers int) []int {
+	var steps []int
+	for n := 1; n < workers; n *= 2 {
+		steps = append(steps, n)
+	}
+	return append(steps, workers)
+}
+
+// Fprint writes the benchmark results and recommendation to w
+func (r *BenchReport) Fprint(w io.Writer) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+
+	fmt.Fprintf(w, "\n%s\n", cyan("=== Benchmark ==="))
+	fmt.Fprintf(w, "Sample: %d blocks, %s encrypted, %s decompressed\n",
+		r.Blocks, formatSize(r.EncryptedSize), formatSize(r.ProcessedSize))
+	fmt.Fprintf(w, "CPUs: %d, multi-core runs use %d goroutines\n\n", runtime.NumCPU(), r.Workers)
+
+	fmt.Fprintf(w, "%-20s %14s %14s %8s\n", "Operation", "1 core", fmt.Sprintf("%d cores", r.Workers), "Speedup")
+	for _, result := range r.Results {
+		fmt.Fprintf(w, "%-20s %14s %14s %7.2fx\n", result.Name,
+			formatThroughput(result.Single), formatThroughput(result.Multi), result.Speedup())
+	}
+
+	fmt.Fprintf(w, "\nPipeline scaling (%s, decompressed bytes):\n", r.Decoder)
+	for _, point := range r.Scaling {
+		fmt.Fprintf(w, "  %3d workers: %14s\n", point.Workers, formatThroughput(point.Throughput))
+	}
+
+	fmt.Fprintf(w, "\n%s\n", cyan("Recommendation:"))
+	fmt.Fprintf(w, "  --decoder %s -w %s\n", r.Decoder, green(fmt.Sprintf("%d", r.RecWorkers)))
+	fmt.Fprintf(w, "  Largest file %s (%s) starts with %d segments; smaller files share the rest\n",
+		r.LargestFile, formatSize(r.LargestSize), r.RecSegments)
+	if r.EstimatedStage > 0 {
+		fmt.Fprintf(w, "  Estimated Stage 2 CPU time for %s: %s (excluding disk I/O)\n",
+			formatSize(r.TotalSize), formatDuration(r.EstimatedStage))
+	}
+}
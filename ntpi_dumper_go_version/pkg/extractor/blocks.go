@@ -0,0 +1,114 @@
+// Package extractor - NTENCODE block enumeration
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+// ntEncodeHeaderSize is the size of the NTEncode header preceding every block
+const ntEncodeHeaderSize = 112
+
+// blockRef locates one NTENCODE block of a file inside Region6
+type blockRef struct {
+	Index    int   // Block index within the file
+	Offset   int64 // Offset of the NTEncode header within Region6
+	KeyIndex int   // Index into KeyMap.bin
+	Start    int64 // Offset of the block's data within the decompressed file
+	Header   structures.NTEncodeHeader
+}
+
+// EncryptedSize returns the size of the encrypted payload following the header
+func (b *blockRef) EncryptedSize() int {
+	return int(b.Header.OriginalSize)
+}
+
+// scanBlocks walks the NTEncode headers of a file and returns every block in order
+func scanBlocks(region6 io.ReaderAt, file parser.FileInfo) ([]blockRef, error) {
+	offsetStart := int64(file.Offset)
+	offsetEnd := offsetStart + int64(file.Length)
+
+	var blocks []blockRef
+	headerBuf := make([]byte, ntEncodeHeaderSize)
+	currentOffset := offsetStart
+	var start int64
+
+	for currentOffset < offsetEnd {
+		blockIndex := len(blocks)
+
+		// Validate header boundaries
+		if currentOffset+ntEncodeHeaderSize > offsetEnd {
+			return nil, fmt.Errorf("block %d at offset %d: %w for NTEncode header",
+				blockIndex, currentOffset, structures.ErrShortData)
+		}
+
+		// Parse block header
+		if _, err := region6.ReadAt(headerBuf, currentOffset); err != nil {
+			return nil, &IOError{Op: "read block header from", Path: "Region6", Err: err}
+		}
+		header, err := structures.ParseNTEncodeHeader(headerBuf)
+		if err != nil {
+			return nil, fmt.Errorf("block %d at offset %d: %w", blockIndex, currentOffset, err)
+		}
+
+		// Validate payload boundaries
+		blockEnd := currentOffset + ntEncodeHeaderSize + int64(header.OriginalSize)
+		if blockEnd > offsetEnd {
+			return nil, fmt.Errorf("block %d at offset %d: %w: encrypted data exceeds file range",
+				blockIndex, currentOffset, structures.ErrShortData)
+		}
+
+		blocks = append(blocks, blockRef{
+			Index:    blockIndex,
+			Offset:   currentOffset,
+			KeyIndex: file.KeyIndex + blockIndex,
+			Start:    start,
+			Header:   *header,
+		})
+
+		// Move to next block
+		currentOffset = blockEnd
+		start += int64(header.ProcessedSize)
+	}
+
+	return blocks, nil
+}
+
+// blockIndex maps the decompressed bytes of a file to the blocks holding them
+type blockIndex struct {
+	blocks []blockRef
+	size   int64 // Decompressed size of the file
+}
+
+// newBlockIndex indexes blocks returned by scanBlocks
+func newBlockIndex(blocks []blockRef) *blockIndex {
+	index := &blockIndex{blocks: blocks}
+	if n := len(blocks); n > 0 {
+		index.size = blocks[n-1].Start + int64(blocks[n-1].Header.ProcessedSize)
+	}
+	return index
+}
+
+// find returns the position of the block containing decompressed offset off,
+// or len(blocks) when off is at or past the end
+func (x *blockIndex) find(off int64) int {
+	return sort.Search(len(x.blocks), func(i int) bool {
+		b := &x.blocks[i]
+		return b.Start+int64(b.Header.ProcessedSize) > off
+	})
+}
+
+// logBlocks logs the NTEncode header details of every block of a file
+func logBlocks(logger logging.Logger, file parser.FileInfo, blocks []blockRef) {
+	for _, block := range blocks {
+		h := &block.Header
+		logger.Verbosef("%s: block %d at offset %d: key index %d, IV %x, compress %d, encrypt %d, %d -> %d bytes",
+			file.Name, block.Index, block.Offset, block.KeyIndex, h.GetIV(),
+			h.CompressSubtype, h.EncryptSubtype, h.OriginalSize, h.ProcessedSize)
+	}
+}
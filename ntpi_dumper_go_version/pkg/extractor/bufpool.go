@@ -0,0 +1,57 @@
+// Package extractor - Pooled block buffers
+package extractor
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	// minPooledClass is the smallest pooled buffer (64 KB); smaller requests round up
+	minPooledClass = 16
+	// maxPooledClass is the largest pooled buffer (256 MB); larger requests are not pooled
+	maxPooledClass = 28
+)
+
+// bufferPools holds one sync.Pool per power-of-two size class. Encrypted
+// payloads and decompressed blocks have a handful of typical sizes, so after
+// warm-up nearly every block is served without a new allocation.
+var bufferPools [maxPooledClass + 1]sync.Pool
+
+// sizeClass returns the power-of-two class that fits n bytes
+func sizeClass(n int) int {
+	if n <= 1<<minPooledClass {
+		return minPooledClass
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// getBuffer returns a buffer of length n, reusing a pooled one when possible
+func getBuffer(n int) []byte {
+	class := sizeClass(n)
+	if class > maxPooledClass {
+		return make([]byte, n)
+	}
+
+	if buf, ok := bufferPools[class].Get().(*[]byte); ok {
+		return (*buf)[:n]
+	}
+	return make([]byte, n, 1<<class)
+}
+
+// putBuffer returns a buffer obtained from getBuffer to its pool. Buffers
+// must not be used after they have been put back.
+func putBuffer(buf []byte) {
+	c := cap(buf)
+	if c == 0 || c&(c-1) != 0 {
+		return // Not from a pool class
+	}
+
+	class := bits.Len(uint(c)) - 1
+	if class < minPooledClass || class > maxPooledClass {
+		return
+	}
+
+	buf = buf[:0]
+	bufferPools[class].Put(&buf)
+}
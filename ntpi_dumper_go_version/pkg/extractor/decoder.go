@@ -0,0 +1,111 @@
+// Package extractor - LZMA2 decoder selection and cross-checking
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Decoder names an LZMA2 implementation
+type Decoder string
+
+const (
+	// DecoderAuto uses liblzma when the binary was built with CGO, pure Go otherwise
+	DecoderAuto Decoder = ""
+	// DecoderLiblzma uses liblzma through CGO
+	DecoderLiblzma Decoder = "liblzma"
+	// DecoderGo uses the pure Go ulikunitz/xz implementation
+	DecoderGo Decoder = "go"
+)
+
+// decodeFunc decodes a raw LZMA2 stream into out, which must be exactly the
+// decompressed size
+type decodeFunc func(compressedData, out []byte, dictSize uint32) error
+
+// ParseDecoder validates a decoder name, rejecting liblzma in builds without CGO
+func ParseDecoder(name string) (Decoder, error) {
+	switch d := Decoder(name); d {
+	case DecoderAuto, "auto":
+		return DecoderAuto, nil
+	case DecoderGo:
+		return d, nil
+	case DecoderLiblzma:
+		if !LiblzmaAvailable {
+			return "", fmt.Errorf("%w: liblzma (built without CGO)", ErrDecoderUnavailable)
+		}
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown decoder %q (want liblzma or go)", name)
+	}
+}
+
+// resolve returns the concrete decoder for d
+func (d Decoder) resolve() Decoder {
+	if d != DecoderAuto {
+		return d
+	}
+	if LiblzmaAvailable {
+		return DecoderLiblzma
+	}
+	return DecoderGo
+}
+
+// newDecodeFunc returns the decode function for the selected decoder. With
+// crossCheck every block is decoded by both implementations and compared.
+func newDecodeFunc(decoder Decoder, crossCheck bool) (decodeFunc, error) {
+	if crossCheck {
+		if !LiblzmaAvailable {
+			return nil, fmt.Errorf("%w: cross-check needs liblzma (built without CGO)", ErrDecoderUnavailable)
+		}
+		return crossCheckLZMA2, nil
+	}
+
+	switch decoder.resolve() {
+	case DecoderLiblzma:
+		if !LiblzmaAvailable {
+			return nil, fmt.Errorf("%w: liblzma (built without CGO)", ErrDecoderUnavailable)
+		}
+		return decodeLZMA2CGO, nil
+	case DecoderGo:
+		return decodeLZMA2PureGo, nil
+	default:
+		return nil, fmt.Errorf("unknown decoder %q", decoder)
+	}
+}
+
+// describeDecoder returns a short description of the decoder setup for output
+func describeDecoder(decoder Decoder, crossCheck bool) string {
+	if crossCheck {
+		return "liblzma + go (cross-check)"
+	}
+	return string(decoder.resolve())
+}
+
+// crossCheckLZMA2 decodes with liblzma into out and with pure Go into a
+// scratch buffer, and fails if the two disagree in any way
+func crossCheckLZMA2(compressedData, out []byte, dictSize uint32) error {
+	cgoErr := decodeLZMA2CGO(compressedData, out, dictSize)
+
+	check := getBuffer(len(out))
+	defer putBuffer(check)
+	goErr := decodeLZMA2PureGo(compressedData, check, dictSize)
+
+	switch {
+	case cgoErr != nil && goErr != nil:
+		return cgoErr // Both reject the stream, so it is simply corrupt
+	case cgoErr != nil:
+		return fmt.Errorf("%w: liblzma failed but go succeeded: %v", ErrDecoderMismatch, cgoErr)
+	case goErr != nil:
+		return fmt.Errorf("%w: go failed but liblzma succeeded: %v", ErrDecoderMismatch, goErr)
+	}
+
+	if !bytes.Equal(out, check) {
+		offset := 0
+		for out[offset] == check[offset] {
+			offset++
+		}
+		return fmt.Errorf("%w: output differs at byte %d", ErrDecoderMismatch, offset)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package extractor - LZMA2 block decompression (shared by all decoders)
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	// ntDecompressHeaderSize is the size of the NTDecompress header; compressed data starts at 0x70
+	ntDecompressHeaderSize = 0x70
+	// maxLZMA2DictSize caps the dictionary of a block decoder at the largest
+	// one the xz presets use (64 MiB); each worker holds one while decoding
+	maxLZMA2DictSize = 64 << 20
+)
+
+// decompressLZMA2 decompresses LZMA2-compressed data from a decrypted NTEncode block
+// with the given decoder. The output is a pooled buffer sized from the header's ProcessedSize.
+func decompressLZMA2(decryptedData []byte, decode decodeFunc) ([]byte, error) {
+	// Validate minimum size for header
+	if len(decryptedData) < ntDecompressHeaderSize {
+		return nil, fmt.Errorf("data too small for NTDecompress header: %d bytes", len(decryptedData))
+	}
+
+	// Validate magic bytes
+	if !bytes.HasPrefix(decryptedData, []byte("NTENCODE")) {
+		return nil, fmt.Errorf("invalid NTDecompress header magic")
+	}
+
+	// Parse decompression header for the output size
+	header, err := structures.ParseNTDecompressHeader(decryptedData[:ntDecompressHeaderSize])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NTDecompress header: %w", err)
+	}
+
+	if ntDecompressHeaderSize >= len(decryptedData) {
+		return nil, fmt.Errorf("data offset exceeds data range")
+	}
+
+	compressedData := decryptedData[ntDecompressHeaderSize:]
+	if header.ProcessedSize > math.MaxInt {
+		return nil, fmt.Errorf("block too large: %d bytes", header.ProcessedSize)
+	}
+
+	// The caller returns the buffer to the pool once it has been written
+	out := getBuffer(int(header.ProcessedSize))
+	if err := decode(compressedData, out, lzma2DictSize(header.ProcessedSize)); err != nil {
+		putBuffer(out)
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// lzma2DictSize returns the dictionary size for decoding a block. Raw LZMA2
+// streams do not record the encoder's dictionary size, and a dictionary never
+// needs to be larger than the data it produces, so small blocks get one of
+// their own size and larger ones maxLZMA2DictSize.
+func lzma2DictSize(processedSize uint64) uint32 {
+	switch {
+	case processedSize < lzma.MinDictCap:
+		return lzma.MinDictCap
+	case processedSize > maxLZMA2DictSize:
+		return maxLZMA2DictSize
+	default:
+		return uint32(processedSize)
+	}
+}
+
+// decodeLZMA2PureGo decodes a raw LZMA2 stream into out using the pure Go
+// implementation (slower but portable). out must be exactly the decompressed size.
+func decodeLZMA2PureGo(compressedData, out []byte, dictSize uint32) error {
+	// Create LZMA2 reader for raw compressed data (not XZ format)
+	lzma2Reader, err := lzma.Reader2Config{DictCap: int(dictSize)}.NewReader2(bytes.NewReader(compressedData))
+	if err != nil {
+		return fmt.Errorf("failed to create LZMA2 reader: %w", err)
+	}
+
+	// Decompress directly into the preallocated buffer
+	if _, err := io.ReadFull(lzma2Reader, out); err != nil {
+		return fmt.Errorf("LZMA2 decompression failed: %w", err)
+	}
+
+	// The stream must end exactly where the header said it would
+	var extra [1]byte
+	if n, err := lzma2Reader.Read(extra[:]); n > 0 || !errors.Is(err, io.EOF) {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("LZMA2 decompression failed: %w", err)
+		}
+		return fmt.Errorf("LZMA2 output exceeds expected size of %d bytes", len(out))
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+// Package extractor - Error types for Stage 2 extraction
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrDecompress is returned when a block cannot be decompressed
+	ErrDecompress = errors.New("decompression failed")
+	// ErrDecoderMismatch is returned by --cross-check when liblzma and pure Go disagree
+	ErrDecoderMismatch = errors.New("decoders disagree")
+	// ErrDecoderUnavailable is returned when the selected decoder is not built in
+	ErrDecoderUnavailable = errors.New("decoder not available")
+	// ErrHashMismatch is returned when extracted data does not match FileIndex.xml
+	ErrHashMismatch = errors.New("hash verification failed")
+	// ErrIO is returned when reading or writing files fails
+	ErrIO = errors.New("I/O error")
+	// ErrInsufficientSpace is returned by preflight when the output will not fit on disk
+	ErrInsufficientSpace = errors.New("not enough disk space")
+	// ErrInsufficientMemory is returned by preflight when extraction would exceed available memory
+	ErrInsufficientMemory = errors.New("not enough memory")
+	// ErrOutputLocked is returned when another run holds the output directory lock
+	ErrOutputLocked = errors.New("output directory is locked")
+)
+
+// DecompressError reports a decompression failure for a block of a file
+type DecompressError struct {
+	Block int // Block index within the file
+	Err   error
+}
+
+func (e *DecompressError) Error() string {
+	return fmt.Sprintf("decompression failed at block %d: %v", e.Block, e.Err)
+}
+
+func (e *DecompressError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrDecompress) match any DecompressError
+func (e *DecompressError) Is(target error) bool {
+	return target == ErrDecompress
+}
+
+// HashMismatchError reports a SHA256 mismatch for an extracted file
+type HashMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("hash verification failed: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// Is makes errors.Is(err, ErrHashMismatch) match any HashMismatchError
+func (e *HashMismatchError) Is(target error) bool {
+	return target == ErrHashMismatch
+}
+
+// IOError reports a failed file operation
+type IOError struct {
+	Op   string // e.g. "create", "write", "rename"
+	Path string
+	Err  error
+}
+
+func (e *IOError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrIO) match any IOError
+func (e *IOError) Is(target error) bool {
+	return target == ErrIO
+}
+
+// FileError ties an extraction failure to the file it happened in
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractionError is returned by ExtractFiles when one or more files failed.
+// It unwraps to every per-file error, so errors.Is/As see all of them.
+type ExtractionError struct {
+	Failed []*FileError
+	Total  int
+}
+
+func (e *ExtractionError) Error() string {
+	names := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		names[i] = f.File
+	}
+	return fmt.Sprintf("%d of %d files failed to extract: %s", len(e.Failed), e.Total, strings.Join(names, ", "))
+}
+
+func (e *ExtractionError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
@@ -0,0 +1,202 @@
+// Package extractor - Read-only io/fs view of an archive
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+// FS returns a read-only file system over the archive. Its files are the
+// FileIndex entries, sized by their PartitionLength and read through
+// partition readers, plus the Stage 1 XMLs at the root. It works with
+// fs.WalkDir, http.FS and testing/fstest.
+func (a *Archive) FS() fs.FS {
+	fsys := &archiveFS{
+		archive: a,
+		nodes:   map[string]*fsNode{".": {name: ".", dir: true, modTime: a.modTime}},
+	}
+
+	for i := range a.Files {
+		file := &a.Files[i]
+		fsys.add(file.Name, &fsNode{partition: file, size: int64(file.PartitionLength)})
+	}
+	// A partition named like a Stage 1 XML keeps the name
+	for name, data := range a.xmls {
+		fsys.add(name, &fsNode{data: data, size: int64(len(data))})
+	}
+
+	for _, node := range fsys.nodes {
+		sort.Slice(node.children, func(i, j int) bool {
+			return node.children[i].name < node.children[j].name
+		})
+	}
+	return fsys
+}
+
+// archiveFS implements fs.FS and fs.StatFS over an Archive
+type archiveFS struct {
+	archive *Archive
+	nodes   map[string]*fsNode // By path; "." is the root
+}
+
+// add inserts a file node at name, creating its parent directories. Names
+// that are not valid fs paths or clash with an existing node are skipped.
+func (fsys *archiveFS) add(name string, node *fsNode) {
+	if !fs.ValidPath(name) || name == "." || fsys.nodes[name] != nil {
+		return
+	}
+	parent := fsys.dir(path.Dir(name))
+	if parent == nil {
+		return
+	}
+
+	node.name = path.Base(name)
+	node.modTime = fsys.archive.modTime
+	parent.children = append(parent.children, node)
+	fsys.nodes[name] = node
+}
+
+// dir returns the directory node at name, creating it and its parents as
+// needed, or nil when a file is in the way
+func (fsys *archiveFS) dir(name string) *fsNode {
+	if node, ok := fsys.nodes[name]; ok {
+		if !node.dir {
+			return nil
+		}
+		return node
+	}
+	parent := fsys.dir(path.Dir(name))
+	if parent == nil {
+		return nil
+	}
+
+	node := &fsNode{name: path.Base(name), dir: true, modTime: fsys.archive.modTime}
+	parent.children = append(parent.children, node)
+	fsys.nodes[name] = node
+	return node
+}
+
+// Open implements fs.FS. Partitions are decoded on demand as they are read.
+func (fsys *archiveFS) Open(name string) (fs.File, error) {
+	node, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case node.dir:
+		return &fsDir{node: node}, nil
+	case node.partition != nil:
+		r, err := fsys.archive.OpenPartition(*node.partition)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &fsFile{SectionReader: io.NewSectionReader(r, 0, r.Size()), node: node}, nil
+	default:
+		return &fsFile{SectionReader: io.NewSectionReader(bytes.NewReader(node.data), 0, node.size), node: node}, nil
+	}
+}
+
+// Stat implements fs.StatFS without opening the file
+func (fsys *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	node, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// lookup finds the node at name, failing with an fs.PathError for op
+func (fsys *archiveFS) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	node, ok := fsys.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return node, nil
+}
+
+// fsNode is a file or directory of an archiveFS. It serves as its own
+// fs.FileInfo and fs.DirEntry.
+type fsNode struct {
+	name      string
+	dir       bool
+	children  []*fsNode        // Sorted by name
+	partition *parser.FileInfo // Set for partitions
+	data      []byte           // Content of a Stage 1 XML
+	size      int64
+	modTime   time.Time
+}
+
+func (n *fsNode) Name() string       { return n.name }
+func (n *fsNode) Size() int64        { return n.size }
+func (n *fsNode) ModTime() time.Time { return n.modTime }
+func (n *fsNode) IsDir() bool        { return n.dir }
+
+// Sys returns the *parser.FileInfo of a partition, or nil
+func (n *fsNode) Sys() any {
+	if n.partition == nil {
+		return nil
+	}
+	return n.partition
+}
+
+func (n *fsNode) Mode() fs.FileMode {
+	if n.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (n *fsNode) Type() fs.FileMode          { return n.Mode().Type() }
+func (n *fsNode) Info() (fs.FileInfo, error) { return n, nil }
+
+// fsFile is an open partition or XML; reads, seeks and ReadAt go through the
+// section reader
+type fsFile struct {
+	*io.SectionReader
+	node *fsNode
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.node, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDir is an open directory
+type fsDir struct {
+	node   *fsNode
+	offset int // Children already returned by ReadDir
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.node, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.node.children[d.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(rest) > n {
+		rest = rest[:n]
+	}
+	d.offset += len(rest)
+
+	entries := make([]fs.DirEntry, len(rest))
+	for i, child := range rest {
+		entries[i] = child
+	}
+	return entries, nil
+}
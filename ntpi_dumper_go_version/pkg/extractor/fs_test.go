@@ -0,0 +1,62 @@
+package extractor
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/internal/ntpitest"
+)
+
+// testFiles returns partitions spanning several blocks, a partial block, a
+// nested directory and an empty file
+func testFiles() []ntpitest.File {
+	boot := make([]byte, 2*ntpitest.BlockSize+1234)
+	for i := range boot {
+		boot[i] = byte(i*i>>7 ^ i)
+	}
+	return []ntpitest.File{
+		{Name: "boot.img", Data: boot},
+		{Name: "sub/vendor.img", Data: bytes.Repeat([]byte("vendor"), 5000)},
+		{Name: "empty.bin"},
+	}
+}
+
+// openTestArchive opens a synthetic archive of files
+func openTestArchive(t *testing.T, files []ntpitest.File) *Archive {
+	t.Helper()
+	archive, err := OpenArchive(ntpitest.Write(t, files...), Options{Reporter: &Recorder{}})
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	t.Cleanup(func() { archive.Close() })
+	return archive
+}
+
+func TestArchiveFS(t *testing.T) {
+	files := testFiles()
+	fsys := openTestArchive(t, files).FS()
+
+	if err := fstest.TestFS(fsys, "boot.img", "sub/vendor.img", "empty.bin", "Metadata.xml", "FileIndex.xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file.Name)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", file.Name, err)
+		}
+		if !bytes.Equal(data, file.Data) {
+			t.Errorf("%s: read %d bytes that differ from the partition", file.Name, len(data))
+		}
+
+		info, err := fs.Stat(fsys, file.Name)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", file.Name, err)
+		}
+		if info.Size() != int64(len(data)) {
+			t.Errorf("%s: Stat().Size() = %d, read %d bytes", file.Name, info.Size(), len(data))
+		}
+	}
+}
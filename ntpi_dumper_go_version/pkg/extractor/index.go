@@ -0,0 +1,349 @@
+// Package extractor - Block index cache shared across runs
+package extractor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+const (
+	// indexFormatVersion is bumped whenever the sidecar layout changes
+	indexFormatVersion = 1
+	// indexHeaderBytes is how much of the start of an archive is hashed into
+	// its cache key, covering the NTPI header and the region chain
+	indexHeaderBytes = 64 << 10
+	// indexCacheEntries is how many sidecars the cache keeps; the least
+	// recently used ones are removed beyond that
+	indexCacheEntries = 64
+)
+
+// indexKey identifies one version of an archive file. A cached index is only
+// used when all of it matches.
+type indexKey struct {
+	Size         int64  `json:"size"`
+	ModTime      int64  `json:"mtime"` // Unix nanoseconds
+	HeaderSHA256 string `json:"header_sha256"`
+}
+
+// indexFile is the JSON sidecar holding the block tables of one archive
+type indexFile struct {
+	Version int                    `json:"version"`
+	Key     indexKey               `json:"key"`
+	Files   map[string]indexedFile `json:"files"`
+}
+
+// indexedFile is the block table of one FileIndex entry. Offset, Length and
+// KeyIndex repeat the entry, so a table is only reused for the same entry.
+type indexedFile struct {
+	Offset   uint64         `json:"offset"`
+	Length   uint64         `json:"length"`
+	KeyIndex int            `json:"key_index"`
+	Blocks   []indexedBlock `json:"blocks"`
+}
+
+// indexedBlock is one blockRef as stored in the sidecar
+type indexedBlock struct {
+	Offset int64  `json:"offset"` // NTEncode header offset within Region6
+	Start  int64  `json:"start"`  // Offset within the decompressed file
+	Size   uint64 `json:"size"`   // Decompressed size
+	Header []byte `json:"header"` // Raw NTEncode header
+}
+
+// archiveIndex hands out the block index of each file of an archive. With a
+// cache directory, indexes are loaded from and saved to a sidecar there, so
+// later runs on the same file skip walking the NTENCODE headers.
+type archiveIndex struct {
+	mu     sync.Mutex
+	path   string // Sidecar file; "" when nothing is persisted
+	key    indexKey
+	stored map[string]indexedFile
+	files  map[string]*blockIndex
+	dirty  bool // stored has entries the sidecar lacks
+	logger logging.Logger
+}
+
+// openArchiveIndex prepares the block indexes of the archive at input, using
+// the sidecar in cacheDir when it matches the file. Cache problems are never
+// fatal: the blocks are simply walked again.
+func openArchiveIndex(cacheDir, input string, logger logging.Logger) *archiveIndex {
+	x := &archiveIndex{
+		stored: make(map[string]indexedFile),
+		files:  make(map[string]*blockIndex),
+		logger: logger,
+	}
+	if cacheDir == "" || input == "" {
+		return x
+	}
+
+	key, err := archiveIndexKey(input)
+	if err != nil {
+		logger.Verbosef("Block index cache disabled: %v", err)
+		return x
+	}
+	keyHash := sha256.Sum256([]byte(fmt.Sprintf("%d/%d/%s", key.Size, key.ModTime, key.HeaderSHA256)))
+	x.key = key
+	x.path = filepath.Join(cacheDir, hex.EncodeToString(keyHash[:16])+".json")
+
+	data, err := os.ReadFile(x.path)
+	if err != nil {
+		return x
+	}
+	var sidecar indexFile
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		logger.Verbosef("Ignoring block index %s: %v", x.path, err)
+		return x
+	}
+	if sidecar.Version != indexFormatVersion || sidecar.Key != key {
+		return x
+	}
+	x.stored = sidecar.Files
+	if x.stored == nil {
+		x.stored = make(map[string]indexedFile)
+	}
+	// The modification time records the last use for pruneIndexCache
+	now := time.Now()
+	os.Chtimes(x.path, now, now)
+	logger.Verbosef("Loaded block index from %s", x.path)
+	return x
+}
+
+// archiveIndexKey builds the cache key of an archive from its size, mtime and
+// the hash of its first indexHeaderBytes
+func archiveIndexKey(input string) (indexKey, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return indexKey{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return indexKey{}, err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, indexHeaderBytes); err != nil && err != io.EOF {
+		return indexKey{}, err
+	}
+	return indexKey{
+		Size:         info.Size(),
+		ModTime:      info.ModTime().UnixNano(),
+		HeaderSHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// lookup returns the block index of file, from memory, the sidecar or by
+// walking its blocks in region6. walked reports the last case, which leaves
+// something for save to write.
+func (x *archiveIndex) lookup(region6 io.ReaderAt, file parser.FileInfo) (index *blockIndex, walked bool, err error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if index, ok := x.files[file.Name]; ok {
+		return index, false, nil
+	}
+
+	if stored, ok := x.stored[file.Name]; ok &&
+		stored.Offset == file.Offset && stored.Length == file.Length && stored.KeyIndex == file.KeyIndex {
+		blocks, err := stored.blockRefs(file)
+		if err == nil {
+			index := newBlockIndex(blocks)
+			x.files[file.Name] = index
+			return index, false, nil
+		}
+		x.logger.Verbosef("Ignoring cached block index of %s: %v", file.Name, err)
+	}
+
+	blocks, err := scanBlocks(region6, file)
+	if err != nil {
+		return nil, false, err
+	}
+	index = newBlockIndex(blocks)
+	x.files[file.Name] = index
+	if x.path != "" {
+		x.stored[file.Name] = newIndexedFile(file, blocks)
+		x.dirty = true
+	}
+	return index, true, nil
+}
+
+// save writes the sidecar if blocks were walked since it was loaded. Failure
+// is only logged, since the cache is an optimization.
+func (x *archiveIndex) save() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.dirty {
+		return
+	}
+	if err := x.write(); err != nil {
+		x.logger.Verbosef("Failed to save block index: %v", err)
+		return
+	}
+	x.dirty = false
+	x.logger.Verbosef("Saved block index to %s", x.path)
+
+	if err := pruneIndexCache(filepath.Dir(x.path), indexCacheEntries); err != nil {
+		x.logger.Verbosef("Failed to prune block index cache: %v", err)
+	}
+}
+
+// isSidecarName reports whether name has the form openArchiveIndex gives sidecars
+func isSidecarName(name string) bool {
+	hash, ok := strings.CutSuffix(name, ".json")
+	if !ok || len(hash) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// pruneIndexCache removes all but the keep most recently used sidecars in dir
+func pruneIndexCache(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type sidecar struct {
+		path    string
+		modTime time.Time
+	}
+	var sidecars []sidecar
+	for _, entry := range entries {
+		if entry.IsDir() || !isSidecarName(entry.Name()) {
+			continue // Not ours, even if the directory is shared
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed meanwhile
+		}
+		sidecars = append(sidecars, sidecar{filepath.Join(dir, entry.Name()), info.ModTime()})
+	}
+	if len(sidecars) <= keep {
+		return nil
+	}
+
+	sort.Slice(sidecars, func(i, j int) bool {
+		return sidecars[i].modTime.After(sidecars[j].modTime)
+	})
+	for _, old := range sidecars[keep:] {
+		if err := os.Remove(old.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// write replaces the sidecar atomically
+func (x *archiveIndex) write() error {
+	data, err := json.Marshal(indexFile{Version: indexFormatVersion, Key: x.key, Files: x.stored})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), ".index-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), x.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// newIndexedFile converts the blocks of a file for the sidecar
+func newIndexedFile(file parser.FileInfo, blocks []blockRef) indexedFile {
+	stored := indexedFile{
+		Offset:   file.Offset,
+		Length:   file.Length,
+		KeyIndex: file.KeyIndex,
+		Blocks:   make([]indexedBlock, len(blocks)),
+	}
+	for i, block := range blocks {
+		var header bytes.Buffer
+		binary.Write(&header, binary.LittleEndian, &block.Header)
+		stored.Blocks[i] = indexedBlock{
+			Offset: block.Offset,
+			Start:  block.Start,
+			Size:   block.Header.ProcessedSize,
+			Header: header.Bytes(),
+		}
+	}
+	return stored
+}
+
+// blockRefs converts a stored block table back. The table must describe the
+// same contiguous run of blocks scanBlocks would find: each block starts where
+// the previous one ended, stays within the file's range, and the last block
+// ends exactly at the end of the range.
+func (s indexedFile) blockRefs(file parser.FileInfo) ([]blockRef, error) {
+	offsetEnd := int64(file.Offset) + int64(file.Length)
+	currentOffset := int64(file.Offset)
+
+	blocks := make([]blockRef, len(s.Blocks))
+	var start int64
+	for i, stored := range s.Blocks {
+		if stored.Offset != currentOffset {
+			return nil, fmt.Errorf("block %d: offset %d, expected %d", i, stored.Offset, currentOffset)
+		}
+		if currentOffset+ntEncodeHeaderSize > offsetEnd {
+			return nil, fmt.Errorf("block %d at offset %d: %w for NTEncode header", i, currentOffset, structures.ErrShortData)
+		}
+		header, err := structures.ParseNTEncodeHeader(stored.Header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		blockEnd := currentOffset + ntEncodeHeaderSize + int64(header.OriginalSize)
+		if header.OriginalSize > uint64(offsetEnd) || blockEnd > offsetEnd {
+			return nil, fmt.Errorf("block %d at offset %d: %w: encrypted data exceeds file range",
+				i, currentOffset, structures.ErrShortData)
+		}
+		if stored.Start != start || stored.Size != header.ProcessedSize {
+			return nil, fmt.Errorf("block %d: inconsistent offsets", i)
+		}
+
+		blocks[i] = blockRef{
+			Index:    i,
+			Offset:   stored.Offset,
+			KeyIndex: file.KeyIndex + i,
+			Start:    stored.Start,
+			Header:   *header,
+		}
+		currentOffset = blockEnd
+		start += int64(header.ProcessedSize)
+	}
+	if currentOffset != offsetEnd {
+		return nil, fmt.Errorf("blocks end at offset %d, file ends at %d", currentOffset, offsetEnd)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,55 @@
+package extractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sidecar returns a sidecar file name made of c
+func sidecar(c string) string {
+	return strings.Repeat(c, 32) + ".json"
+}
+
+func TestPruneIndexCache(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	names := []string{sidecar("a"), sidecar("b"), sidecar("c"), sidecar("d"), sidecar("e")}
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// a was used last, then e, d, ...
+		used := base.Add(time.Duration(i) * time.Minute)
+		if i == 0 {
+			used = base.Add(time.Hour)
+		}
+		if err := os.Chtimes(path, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, other := range []string{"notes.txt", "settings.json"} {
+		if err := os.WriteFile(filepath.Join(dir, other), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneIndexCache(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	want := []string{sidecar("a"), sidecar("e"), "notes.txt", "settings.json"}
+	if strings.Join(left, " ") != strings.Join(want, " ") {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
@@ -0,0 +1,53 @@
+// Package extractor - Output directory locking
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// lockFileName is created inside the output directory while an extraction runs
+const lockFileName = ".ntpi-dumper.lock"
+
+// OutputLock guards an output directory against concurrent extractions
+type OutputLock struct {
+	path string
+	once sync.Once
+}
+
+// AcquireOutputLock creates outputDir if needed and takes an exclusive lock on it.
+// It fails if another run already holds the lock.
+func AcquireOutputLock(outputDir string) (*OutputLock, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, &IOError{Op: "create directory", Path: outputDir, Err: err}
+	}
+
+	lockPath := filepath.Join(outputDir, lockFileName)
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("%w: in use by another extraction "+
+				"(remove %s if no other run is active)", ErrOutputLocked, lockPath)
+		}
+		return nil, &IOError{Op: "lock", Path: outputDir, Err: err}
+	}
+
+	// Record the owner for whoever finds a stale lock
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	file.Close()
+
+	return &OutputLock{path: lockPath}, nil
+}
+
+// Release removes the lock file. It is safe to call more than once and on a nil lock.
+func (l *OutputLock) Release() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+}
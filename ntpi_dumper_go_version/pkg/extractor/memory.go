@@ -0,0 +1,102 @@
+// Package extractor - Memory budget for in-flight decompressed data
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/sysinfo"
+)
+
+// defaultMemoryBudget is used when available memory cannot be determined
+const defaultMemoryBudget = 2 * 1024 * 1024 * 1024
+
+// memoryBudget limits how many decompressed bytes may be in flight at once.
+// Reservations are made in submission order by the feeder, so a block that
+// the writers are waiting for always holds its reservation and the budget
+// can never deadlock.
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit uint64 // 0 means unlimited
+	used  uint64
+}
+
+// newMemoryBudget creates a budget of limit bytes (0 for unlimited)
+func newMemoryBudget(limit uint64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes fit in the budget. A single reservation larger
+// than the whole budget is allowed once nothing else is in flight.
+func (b *memoryBudget) acquire(n uint64) {
+	if b.limit == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+}
+
+// release returns n bytes to the budget
+func (b *memoryBudget) release(n uint64) {
+	if b.limit == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// resolveMaxMemory picks the memory budget. Without an explicit limit half of
+// the currently available memory is used, leaving room for the rest of the
+// process and the system so extraction never pushes the machine into swap.
+func resolveMaxMemory(maxMemory uint64) uint64 {
+	if maxMemory > 0 {
+		return maxMemory
+	}
+	if available, err := sysinfo.AvailableMemory(); err == nil && available > 0 {
+		return available / 2
+	}
+	return defaultMemoryBudget
+}
+
+// ParseSize parses a human-readable size such as "512MB", "4G" or "1073741824"
+func ParseSize(s string) (uint64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+
+	multiplier := uint64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1024
+		case 'M':
+			multiplier = 1024 * 1024
+		case 'G':
+			multiplier = 1024 * 1024 * 1024
+		case 'T':
+			multiplier = 1024 * 1024 * 1024 * 1024
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return uint64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,105 @@
+package extractor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/internal/ntpitest"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+func TestMemoryBudgetBlocks(t *testing.T) {
+	b := newMemoryBudget(100)
+	b.acquire(60)
+
+	acquired := make(chan struct{})
+	go func() {
+		b.acquire(60)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.release(60)
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("release did not wake the waiting acquire")
+	}
+
+	// A reservation larger than the whole budget fits once nothing is in flight
+	b.release(60)
+	b.acquire(500)
+	b.release(500)
+}
+
+func TestExtractFilesWithinBudget(t *testing.T) {
+	big := make([]byte, 6*ntpitest.BlockSize+99)
+	for i := range big {
+		big[i] = byte(i>>8 ^ i*13)
+	}
+	files := append(testFiles(), ntpitest.File{Name: "big.img", Data: big})
+	input := ntpitest.Write(t, files...)
+	tempDir := filepath.Join(t.TempDir(), "stage1")
+	outputDir := filepath.Join(t.TempDir(), "out")
+	if err := parser.ParseNTPIFile(input, tempDir, parser.Options{}); err != nil {
+		t.Fatalf("ParseNTPIFile: %v", err)
+	}
+
+	// Room for one block at a time, so the feeder blocks on every other block
+	limit := uint64(ntpitest.BlockSize)
+	pool, err := NewPool(Options{Workers: 4, MaxMemory: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	budget := pool.blocks.budget
+	var peak uint64
+	decode := pool.blocks.decode
+	pool.blocks.decode = func(compressedData, out []byte, dictSize uint32) error {
+		budget.mu.Lock()
+		peak = max(peak, budget.used)
+		budget.mu.Unlock()
+		return decode(compressedData, out, dictSize)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ExtractFiles(tempDir, outputDir, Options{Pool: pool})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ExtractFiles: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("ExtractFiles deadlocked under the memory budget")
+	}
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	if peak > limit {
+		t.Errorf("%d bytes in flight, budget %d", peak, limit)
+	}
+	if budget.used != 0 {
+		t.Errorf("%d bytes still reserved after extraction", budget.used)
+	}
+
+	// Blocks are decoded out of order but must be written in order
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(file.Name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, file.Data) {
+			t.Errorf("%s: extracted data differs from the partition", file.Name)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package extractor - Atomic output file handling
+package extractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// partialSuffix is appended to output files while they are being written
+	partialSuffix = ".partial"
+	// failedDirName is the directory (inside the output directory) that receives
+	// files which failed hash verification
+	failedDirName = ".failed"
+)
+
+// outputFile writes a partition to a ".partial" file next to its final path.
+// Everything written is hashed on the fly; the file only receives its final
+// name after it has been synced to disk and its hash has been verified.
+type outputFile struct {
+	outputDir   string
+	name        string
+	finalPath   string
+	partialPath string
+	hash        hash.Hash
+	timing      *phaseTimer
+
+	mu   sync.Mutex // Guards file, which AbortOutputs may close from another goroutine
+	file *os.File   // nil once committed or aborted
+}
+
+var (
+	openOutputsMu sync.Mutex
+	openOutputs   = make(map[*outputFile]bool) // Partial files not yet committed or aborted
+)
+
+// AbortOutputs discards the partial file of every partition still being
+// written. Signal handlers call it before exiting, since the writers never
+// get to clean up themselves; later writes to those files fail.
+func AbortOutputs() {
+	openOutputsMu.Lock()
+	outputs := make([]*outputFile, 0, len(openOutputs))
+	for o := range openOutputs {
+		outputs = append(outputs, o)
+	}
+	openOutputsMu.Unlock()
+
+	for _, o := range outputs {
+		o.Abort(false)
+	}
+}
+
+// setOpen adds or removes o from the outputs AbortOutputs discards
+func (o *outputFile) setOpen(open bool) {
+	openOutputsMu.Lock()
+	defer openOutputsMu.Unlock()
+	if open {
+		openOutputs[o] = true
+	} else {
+		delete(openOutputs, o)
+	}
+}
+
+// createOutputFile creates the ".partial" file for a partition inside outputDir.
+// Time spent writing and hashing is recorded in timing.
+func createOutputFile(outputDir, name string, timing *phaseTimer) (*outputFile, error) {
+	finalPath := filepath.Join(outputDir, name)
+	partialPath := finalPath + partialSuffix
+
+	// Create parent directories
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return nil, &IOError{Op: "create directory", Path: filepath.Dir(finalPath), Err: err}
+	}
+
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, &IOError{Op: "create", Path: partialPath, Err: err}
+	}
+
+	o := &outputFile{
+		outputDir:   outputDir,
+		name:        name,
+		finalPath:   finalPath,
+		partialPath: partialPath,
+		file:        file,
+		hash:        sha256.New(),
+		timing:      timing,
+	}
+	o.setOpen(true)
+	return o, nil
+}
+
+// Write appends data to the partial file and updates the running hash
+func (o *outputFile) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	if o.file == nil {
+		o.mu.Unlock()
+		return 0, &IOError{Op: "write", Path: o.partialPath, Err: os.ErrClosed}
+	}
+	start := time.Now()
+	n, err := o.file.Write(p)
+	o.timing.add(phaseWrite, start, n)
+	o.mu.Unlock()
+
+	start = time.Now()
+	o.hash.Write(p[:n])
+	o.timing.add(phaseHash, start, n)
+
+	if err != nil {
+		return n, &IOError{Op: "write", Path: o.partialPath, Err: err}
+	}
+	return n, nil
+}
+
+// Commit syncs the partial file, verifies its hash and renames it into place.
+// On hash mismatch the file is moved to the .failed directory; on any other
+// error it is removed. Either way nothing is left under the final name.
+func (o *outputFile) Commit(expectedHash string) error {
+	o.mu.Lock()
+	file := o.file
+	o.file = nil
+	o.mu.Unlock()
+	if file == nil {
+		return &IOError{Op: "sync", Path: o.partialPath, Err: os.ErrClosed}
+	}
+
+	start := time.Now()
+	err := file.Sync()
+	o.timing.add(phaseWrite, start, 0)
+	if err != nil {
+		file.Close()
+		o.Abort(false)
+		return &IOError{Op: "sync", Path: o.partialPath, Err: err}
+	}
+	if err := file.Close(); err != nil {
+		o.Abort(false)
+		return &IOError{Op: "close", Path: o.partialPath, Err: err}
+	}
+
+	actualHash := hex.EncodeToString(o.hash.Sum(nil))
+	if !strings.EqualFold(actualHash, expectedHash) {
+		o.Abort(true)
+		return &HashMismatchError{Expected: expectedHash, Actual: actualHash}
+	}
+
+	if err := os.Rename(o.partialPath, o.finalPath); err != nil {
+		o.Abort(false)
+		return &IOError{Op: "rename", Path: o.partialPath, Err: err}
+	}
+
+	o.setOpen(false)
+	syncDir(filepath.Dir(o.finalPath))
+	return nil
+}
+
+// Abort discards the partial file. When keep is true the data is moved to the
+// .failed directory for inspection instead of being deleted.
+func (o *outputFile) Abort(keep bool) {
+	o.mu.Lock()
+	if o.file != nil {
+		o.file.Close()
+		o.file = nil
+	}
+	o.mu.Unlock()
+	o.setOpen(false)
+
+	if keep {
+		failedPath := filepath.Join(o.outputDir, failedDirName, o.name)
+		if err := os.MkdirAll(filepath.Dir(failedPath), 0755); err == nil {
+			if err := os.Rename(o.partialPath, failedPath); err == nil {
+				return
+			}
+		}
+	}
+
+	os.Remove(o.partialPath)
+}
+
+// syncDir flushes directory metadata so a completed rename survives a crash.
+// Errors are ignored: not every platform supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,44 @@
+package extractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAbortOutputs(t *testing.T) {
+	dir := t.TempDir()
+	var timing phaseTimer
+	done, err := createOutputFile(dir, "done.img", &timing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done.Write([]byte("data"))
+	if err := done.Commit("3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"); err != nil {
+		t.Fatal(err)
+	}
+
+	open, err := createOutputFile(dir, "sub/open.img", &timing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open.Write([]byte("partial"))
+
+	AbortOutputs()
+
+	if _, err := os.Stat(filepath.Join(dir, "sub", "open.img"+partialSuffix)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "done.img")); err != nil {
+		t.Errorf("committed file removed: %v", err)
+	}
+
+	// The writer has not noticed yet; its next write must fail, not panic
+	if _, err := open.Write([]byte("more")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after abort: got %v, want os.ErrClosed", err)
+	}
+	if err := open.Commit(""); err == nil {
+		t.Error("Commit after abort succeeded")
+	}
+}
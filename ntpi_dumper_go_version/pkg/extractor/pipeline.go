@@ -0,0 +1,208 @@
+// Package extractor - Block pipeline feeding ordered per-file writers
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+// archiveSource holds the Stage 1 outputs of one NTPI archive that Stage 2 reads from
+type archiveSource struct {
+	region6   io.ReaderAt
+	ciphers   *crypto.CipherCache // One AES cipher per KeyMap key
+	index     *archiveIndex       // Block index of every file
+	outputDir string
+	reporter  Reporter // Receives file and block events
+}
+
+// fileJob tracks one file while its blocks move through the pool
+type fileJob struct {
+	archive *archiveSource
+	info    parser.FileInfo
+	blocks  []blockRef
+	results chan blockResult
+	budget  *memoryBudget
+	failed  atomic.Bool // Set on the first error so remaining blocks are skipped
+	timing  phaseTimer
+
+	// Scheduling state, guarded by blockScheduler.mu
+	scheduler  *blockScheduler
+	nextBlock  int    // Next block to dispatch
+	inFlight   int    // Blocks dispatched but not yet received by the writer
+	undispatch uint64 // Decompressed bytes not yet dispatched
+}
+
+// newFileJob prepares a file whose blocks have already been enumerated
+func newFileJob(archive *archiveSource, info parser.FileInfo, blocks []blockRef, pool *blockPool) *fileJob {
+	job := &fileJob{
+		archive: archive,
+		info:    info,
+		blocks:  blocks,
+		results: make(chan blockResult, pool.workers),
+		budget:  pool.budget,
+	}
+	for _, block := range blocks {
+		job.undispatch += block.Header.ProcessedSize
+	}
+	return job
+}
+
+// processFiles enumerates the blocks of all files and feeds them through the
+// shared pool, largest files first. Each file gets an ordered writer that
+// reassembles its blocks and reports its progress to the archive's reporter.
+// The pool stays open for other archives. maxSegments caps the blocks of one
+// file in flight (0 = no cap beyond the workers).
+func processFiles(archive *archiveSource, files []parser.FileInfo, pool *blockPool, maxSegments int) []FileResult {
+	results := make([]FileResult, len(files))
+
+	// Enumerate blocks of every file up front
+	jobs := make([]*fileJob, len(files))
+	for i, file := range files {
+		archive.reporter.FileQueued(file)
+		index, _, err := archive.index.lookup(archive.region6, file)
+		if err != nil {
+			err = fmt.Errorf("failed to enumerate blocks: %w", err)
+			results[i] = FileResult{
+				FileName: file.Name,
+				Success:  false,
+				Message:  err.Error(),
+				Err:      err,
+			}
+			archive.reporter.FileDone(file, results[i])
+			continue
+		}
+		logBlocks(archive.reporter, file, index.blocks)
+		jobs[i] = newFileJob(archive, file, index.blocks, pool)
+	}
+
+	scheduler := newBlockScheduler(jobs, pool.workers, maxSegments)
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+		if job == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(idx int, job *fileJob) {
+			defer wg.Done()
+			results[idx] = job.writeOrdered()
+		}(i, job)
+	}
+
+	scheduler.feed(pool)
+	wg.Wait()
+
+	return results
+}
+
+// writeOrdered receives decoded blocks in any order, writes them to the output
+// file in block order and verifies the result
+func (f *fileJob) writeOrdered() (result FileResult) {
+	startTime := time.Now()
+	file := f.info
+
+	defer func() {
+		result.Duration = time.Since(startTime)
+		f.archive.reporter.FileDone(file, result)
+	}()
+
+	fail := func(err error) FileResult {
+		return FileResult{
+			FileName: file.Name,
+			Success:  false,
+			Message:  err.Error(),
+			Err:      err,
+			Stats:    newFileStats(f),
+		}
+	}
+
+	// Write to a .partial file that is only renamed into place once verified
+	out, err := createOutputFile(f.archive.outputDir, file.Name, &f.timing)
+	if err != nil {
+		f.failed.Store(true)
+		f.drain(0)
+		return fail(err)
+	}
+
+	pending := make(map[int][]byte)
+	nextIndex := 0
+	processedBytes := int64(0)
+	var firstErr error
+
+	for received := 0; received < len(f.blocks); received++ {
+		r := <-f.results
+		f.scheduler.done(f)
+		if firstErr != nil || r.err != nil {
+			// Failed blocks and everything after a failure are discarded
+			putBuffer(r.data)
+			f.releaseBlock(r.index)
+			if firstErr == nil {
+				firstErr = r.err
+				f.failed.Store(true)
+			}
+			continue
+		}
+
+		// Flush every block that is now contiguous
+		pending[r.index] = r.data
+		for data, ok := pending[nextIndex]; ok; data, ok = pending[nextIndex] {
+			delete(pending, nextIndex)
+			_, err := out.Write(data)
+			putBuffer(data)
+			f.releaseBlock(nextIndex)
+			if err != nil {
+				firstErr = err
+				f.failed.Store(true)
+				break
+			}
+
+			// Report progress with actual decompressed bytes
+			processedBytes += int64(len(data))
+			f.archive.reporter.FileProgress(file, processedBytes)
+			nextIndex++
+		}
+	}
+
+	if firstErr != nil {
+		for index, data := range pending {
+			putBuffer(data)
+			f.releaseBlock(index)
+		}
+		out.Abort(false)
+		return fail(firstErr)
+	}
+
+	// Sync, verify hash and move into place
+	if err := out.Commit(file.FileSha256Hash); err != nil {
+		return fail(err)
+	}
+
+	return FileResult{
+		FileName: file.Name,
+		Success:  true,
+		Message:  "OK",
+		Stats:    newFileStats(f),
+	}
+}
+
+// drain discards the remaining results of a failed file so workers never block
+func (f *fileJob) drain(received int) {
+	for ; received < len(f.blocks); received++ {
+		r := <-f.results
+		f.scheduler.done(f)
+		putBuffer(r.data)
+		f.releaseBlock(r.index)
+	}
+}
+
+// releaseBlock returns a block's memory reservation to the budget
+func (f *fileJob) releaseBlock(index int) {
+	f.budget.release(f.blocks[index].Header.ProcessedSize)
+}
@@ -0,0 +1,171 @@
+// Package extractor - Global block-level decrypt/decompress pool
+package extractor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+)
+
+// blockJob asks the pool to decode one block of a file
+type blockJob struct {
+	file  *fileJob
+	block blockRef
+}
+
+// blockResult carries a decoded block back to its file's ordered writer
+type blockResult struct {
+	index int
+	data  []byte
+	err   error
+}
+
+// blockPool is a fixed-size set of goroutines that decrypt and decompress
+// blocks from every selected file. All files share the pool, so the CPU stays
+// busy regardless of how file sizes are distributed.
+type blockPool struct {
+	jobs    chan blockJob
+	workers int
+	budget  *memoryBudget
+	decode  decodeFunc
+	wg      sync.WaitGroup
+}
+
+// newBlockPool starts numWorkers decoding goroutines sharing a memory budget
+// of maxMemory decompressed bytes (0 for unlimited)
+func newBlockPool(numWorkers int, maxMemory uint64, decode decodeFunc) *blockPool {
+	p := &blockPool{
+		// A short queue keeps workers fed without reading far ahead
+		jobs:    make(chan blockJob, numWorkers*2),
+		workers: numWorkers,
+		budget:  newMemoryBudget(maxMemory),
+		decode:  decode,
+	}
+
+	for i := 0; i < numWorkers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p
+}
+
+// Pool is a block decoding pool that can be shared by several ExtractFiles
+// calls, so a batch of archives is decoded by one set of goroutines under one
+// memory budget
+type Pool struct {
+	blocks    *blockPool
+	maxMemory uint64
+	decoder   string // Description of the LZMA2 implementation
+}
+
+// NewPool starts a pool configured by the Workers, MaxMemory, Decoder and
+// CrossCheck options
+func NewPool(opts Options) (*Pool, error) {
+	decode, err := newDecodeFunc(opts.Decoder, opts.CrossCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMemory := resolveMaxMemory(opts.MaxMemory)
+	return &Pool{
+		blocks:    newBlockPool(resolveWorkers(opts.Workers), maxMemory, decode),
+		maxMemory: maxMemory,
+		decoder:   describeDecoder(opts.Decoder, opts.CrossCheck),
+	}, nil
+}
+
+// Workers returns the number of decoding goroutines
+func (p *Pool) Workers() int {
+	return p.blocks.workers
+}
+
+// Close stops the pool. It must not be used by ExtractFiles afterwards.
+func (p *Pool) Close() {
+	p.blocks.close()
+}
+
+// submit reserves memory for the block's decompressed data and queues it for
+// decoding, blocking while the budget or the queue is full. The file's writer
+// releases the reservation once the data has been written or discarded.
+func (p *blockPool) submit(job blockJob) {
+	p.budget.acquire(job.block.Header.ProcessedSize)
+	p.jobs <- job
+}
+
+// close stops the pool after all queued blocks have been decoded
+func (p *blockPool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// worker decodes blocks until the pool is closed
+func (p *blockPool) worker() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		// Once a file has failed, skip its remaining blocks
+		if job.file.failed.Load() {
+			job.file.results <- blockResult{index: job.block.Index}
+			continue
+		}
+
+		data, err := decodeBlock(job, p.decode)
+		if err == nil {
+			job.file.archive.reporter.BlockDecoded(job.file.info, job.block.Index, len(data))
+		}
+		job.file.results <- blockResult{index: job.block.Index, data: data, err: err}
+	}
+}
+
+// decodeBlock reads, decrypts and decompresses a single block. A panic is
+// turned into an error so one bad block cannot take down the whole process.
+func decodeBlock(job blockJob, decode decodeFunc) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("block %d: panic: %v", job.block.Index, r)
+		}
+	}()
+
+	block := job.block
+	archive := job.file.archive
+
+	timing := &job.file.timing
+
+	// Read encrypted payload into a pooled buffer; it is decrypted in place
+	buf := getBuffer(block.EncryptedSize())
+	defer putBuffer(buf)
+
+	start := time.Now()
+	n, err := archive.region6.ReadAt(buf, block.Offset+ntEncodeHeaderSize)
+	timing.add(phaseRead, start, n)
+	if err != nil {
+		return nil, &IOError{Op: "read block from", Path: "Region6", Err: err}
+	}
+
+	// Look up the cached cipher for the block's key
+	start = time.Now()
+	cipherBlock := archive.ciphers.Cipher(block.KeyIndex)
+	timing.add(phaseKeyLookup, start, 0)
+
+	// Decrypt block
+	start = time.Now()
+	decryptedData, err := crypto.DecryptNTEncodePayloadInto(buf, &block.Header, buf, cipherBlock)
+	timing.add(phaseDecrypt, start, len(buf))
+	if err != nil {
+		// err already wraps crypto.ErrDecrypt
+		return nil, fmt.Errorf("block %d at offset %d: %w", block.Index, block.Offset, err)
+	}
+
+	// Decompress block
+	start = time.Now()
+	decompressedData, err := decompressLZMA2(decryptedData, decode)
+	timing.add(phaseDecompress, start, len(decompressedData))
+	if err != nil {
+		return nil, &DecompressError{Block: block.Index, Err: err}
+	}
+
+	return decompressedData, nil
+}
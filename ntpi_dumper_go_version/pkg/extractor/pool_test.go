@@ -0,0 +1,29 @@
+package extractor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
+)
+
+func TestDecodeBlockDecryptError(t *testing.T) {
+	archive := openTestArchive(t, testFiles())
+	file, _ := archive.Lookup("boot.img")
+	index, err := archive.index(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A payload that is not a whole number of AES blocks cannot be decrypted
+	block := index.blocks[0]
+	block.Header.OriginalSize--
+	_, err = decodeBlock(blockJob{file: &fileJob{archive: archive.source, info: file}, block: block}, archive.decode)
+	if !errors.Is(err, crypto.ErrDecrypt) {
+		t.Fatalf("got %v, want ErrDecrypt", err)
+	}
+	if n := strings.Count(err.Error(), crypto.ErrDecrypt.Error()); n != 1 {
+		t.Errorf("%q says %q %d times", err, crypto.ErrDecrypt, n)
+	}
+}
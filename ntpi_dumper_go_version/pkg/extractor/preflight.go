@@ -0,0 +1,195 @@
+// Package extractor - Preflight planning (disk space, memory and block layout)
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/sysinfo"
+	"github.com/fatih/color"
+)
+
+// FilePlan describes how a single file will be extracted
+type FilePlan struct {
+	Name     string
+	Size     uint64 // PartitionLength (decompressed size)
+	Blocks   int    // Number of NTENCODE blocks fed to the pool
+	Segments int    // Blocks of this file decoded in parallel when Stage 2 starts
+}
+
+// Plan summarizes what Stage 2 will do and what it needs
+type Plan struct {
+	Files       []FilePlan // In scheduling order, largest first
+	Workers     int
+	TotalSize   uint64 // Sum of PartitionLength for all selected files
+	TotalBlocks int
+	Region6Size uint64
+	MaxMemory   uint64 // Budget for in-flight decompressed data
+	Decoder     string // LZMA2 decoder description
+	PeakMemory  uint64 // Estimated peak memory use during Stage 2
+
+	OutputDir       string
+	OutputFree      uint64 // 0 when unknown
+	MemoryAvailable uint64 // 0 when unknown
+}
+
+// BuildPlan reads the Stage 1 results from tempDir and works out the Stage 2 plan
+func BuildPlan(tempDir, outputDir string, opts Options) (*Plan, error) {
+	files, err := parser.ParseFileIndex(filepath.Join(tempDir, "FileIndex.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FileIndex.xml: %w", err)
+	}
+	files, err = opts.selectFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	region6File, err := os.Open(filepath.Join(tempDir, "region6block.bin"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Region6 data: %w", err)
+	}
+	defer region6File.Close()
+
+	region6Info, err := region6File.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat Region6 data: %w", err)
+	}
+
+	keyMapInfo, err := os.Stat(filepath.Join(tempDir, "KeyMap.bin"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat KeyMap: %w", err)
+	}
+
+	plan := &Plan{
+		Workers:     resolveWorkers(opts.Workers),
+		MaxMemory:   resolveMaxMemory(opts.MaxMemory),
+		Decoder:     describeDecoder(opts.Decoder, opts.CrossCheck),
+		Region6Size: uint64(region6Info.Size()),
+		OutputDir:   outputDir,
+	}
+
+	// Stage 2 reuses the block indexes through the cache; a dry run leaves it alone
+	index := openArchiveIndex(opts.IndexCache, opts.Input, opts.reporter())
+	if !opts.DryRun {
+		defer index.save()
+	}
+
+	var maxEncrypted, maxProcessed uint64
+	for _, file := range files {
+		fileIndex, _, err := index.lookup(region6File, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to enumerate blocks: %w", file.Name, err)
+		}
+		blocks := fileIndex.blocks
+		for _, block := range blocks {
+			if block.Header.OriginalSize > maxEncrypted {
+				maxEncrypted = block.Header.OriginalSize
+			}
+			if block.Header.ProcessedSize > maxProcessed {
+				maxProcessed = block.Header.ProcessedSize
+			}
+		}
+
+		plan.Files = append(plan.Files, FilePlan{
+			Name:   file.Name,
+			Size:   file.PartitionLength,
+			Blocks: len(blocks),
+		})
+		plan.TotalSize += file.PartitionLength
+		plan.TotalBlocks += len(blocks)
+	}
+
+	// Files are scheduled largest first, each starting with its share of the workers
+	sort.SliceStable(plan.Files, func(i, j int) bool {
+		return plan.Files[i].Size > plan.Files[j].Size
+	})
+	for i := range plan.Files {
+		plan.Files[i].Segments = segmentLimit(plan.Workers, opts.Segments, plan.Files[i].Size, plan.TotalSize)
+	}
+
+	// Blocks are read on demand, so memory is bounded by the blocks in flight:
+	// the pool queue plus one per worker, each holding its encrypted and
+	// decrypted copies. Decompressed data waiting to be written is capped by
+	// the memory budget (but a single block always fits).
+	inFlight := uint64(3 * plan.Workers)
+	if inFlight > uint64(plan.TotalBlocks) {
+		inFlight = uint64(plan.TotalBlocks)
+	}
+	decompressed := inFlight * maxProcessed
+	if budget := max(plan.MaxMemory, maxProcessed); decompressed > budget {
+		decompressed = budget
+	}
+	plan.PeakMemory = uint64(keyMapInfo.Size()) + inFlight*2*maxEncrypted + decompressed
+	// Each decoding worker also holds an LZMA2 dictionary
+	plan.PeakMemory += uint64(min(plan.Workers, plan.TotalBlocks)) * uint64(lzma2DictSize(maxProcessed))
+	if opts.CrossCheck {
+		// Each worker also holds a second decoded copy to compare against
+		plan.PeakMemory += uint64(min(plan.Workers, plan.TotalBlocks)) * maxProcessed
+	}
+
+	if free, err := sysinfo.DiskFree(outputDir); err == nil {
+		plan.OutputFree = free
+	}
+	if available, err := sysinfo.AvailableMemory(); err == nil {
+		plan.MemoryAvailable = available
+	}
+
+	return plan, nil
+}
+
+// Check returns an error if the output filesystem or memory is known to be too small
+func (p *Plan) Check() error {
+	if p.OutputFree > 0 && p.TotalSize > p.OutputFree {
+		return fmt.Errorf("%w in %s: need %s, have %s",
+			ErrInsufficientSpace, p.OutputDir, formatSize(p.TotalSize), formatSize(p.OutputFree))
+	}
+	if p.MemoryAvailable > 0 && p.PeakMemory > p.MemoryAvailable {
+		return fmt.Errorf("%w: need about %s, have %s available (try fewer workers or a lower --max-memory)",
+			ErrInsufficientMemory, formatSize(p.PeakMemory), formatSize(p.MemoryAvailable))
+	}
+	return nil
+}
+
+// Fprint writes the plan to w
+func (p *Plan) Fprint(w io.Writer) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	fmt.Fprintf(w, "\n%s\n", cyan("=== Preflight Plan ==="))
+	fmt.Fprintf(w, "Worker goroutines: %s\n", cyan(fmt.Sprintf("%d", p.Workers)))
+	fmt.Fprintf(w, "Decoder: %s\n", cyan(p.Decoder))
+	fmt.Fprintf(w, "Files: %s (%d blocks)\n", cyan(fmt.Sprintf("%d", len(p.Files))), p.TotalBlocks)
+	for _, file := range p.Files {
+		fmt.Fprintf(w, "  %-45s %10s  %s\n", truncateFileName(file.Name, 45), formatSize(file.Size),
+			yellow(fmt.Sprintf("%d blocks, %d segments", file.Blocks, file.Segments)))
+	}
+	fmt.Fprintf(w, "Output size: %s (free: %s)\n", cyan(formatSize(p.TotalSize)), formatOptionalSize(p.OutputFree))
+	fmt.Fprintf(w, "Memory budget: %s\n", cyan(formatSize(p.MaxMemory)))
+	fmt.Fprintf(w, "Estimated peak memory: %s (available: %s)\n", cyan(formatSize(p.PeakMemory)), formatOptionalSize(p.MemoryAvailable))
+}
+
+// CheckTempSpace verifies that tempDir can hold the Region6 copy made in Stage 1,
+// which is at most the size of the input file
+func CheckTempSpace(tempDir string, inputSize uint64) error {
+	free, err := sysinfo.DiskFree(tempDir)
+	if err != nil {
+		return nil // Unknown, let Stage 1 find out
+	}
+	if inputSize > free {
+		return fmt.Errorf("%w in temp directory %s: need %s, have %s",
+			ErrInsufficientSpace, tempDir, formatSize(inputSize), formatSize(free))
+	}
+	return nil
+}
+
+// formatOptionalSize formats a size that may be unknown (zero)
+func formatOptionalSize(bytes uint64) string {
+	if bytes == 0 {
+		return "unknown"
+	}
+	return formatSize(bytes)
+}
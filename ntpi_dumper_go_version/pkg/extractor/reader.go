@@ -0,0 +1,179 @@
+// Package extractor - Random access to decompressed partitions
+package extractor
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+// blockCacheSize is the number of decoded blocks an Archive keeps for its
+// partition readers
+const blockCacheSize = 8
+
+// PartitionReader reads the decompressed data of one partition at any offset.
+// Only the blocks a read touches are decrypted and decompressed, and recently
+// used blocks are shared through the archive's cache. Each reader also keeps
+// the last block it read, so sequential reads in small chunks decode every
+// block once even when other readers evict it from the cache. It is safe for
+// concurrent use.
+type PartitionReader struct {
+	archive *Archive
+	job     *fileJob
+	index   *blockIndex
+
+	mu   sync.Mutex
+	last int    // Position in index.blocks of data
+	data []byte // Last block read; nil before the first read
+}
+
+// OpenPartition returns a random-access reader for a partition. The data is
+// not verified, since a read does not see the whole partition.
+func (a *Archive) OpenPartition(file parser.FileInfo) (*PartitionReader, error) {
+	index, err := a.index(file)
+	if err != nil {
+		return nil, err
+	}
+	return &PartitionReader{
+		archive: a,
+		job:     &fileJob{archive: a.source, info: file},
+		index:   index,
+	}, nil
+}
+
+// Size returns the decompressed size of the partition
+func (r *PartitionReader) Size() int64 {
+	return r.index.size
+}
+
+// ReadAt implements io.ReaderAt
+func (r *PartitionReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("%s: negative offset %d", r.job.info.Name, off)
+	}
+
+	for i := r.index.find(off); n < len(p) && i < len(r.index.blocks); i++ {
+		data, err := r.block(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[off+int64(n)-r.index.blocks[i].Start:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the decoded block at position i of the index, from the
+// reader's last block or the archive's cache
+func (r *PartitionReader) block(i int) ([]byte, error) {
+	r.mu.Lock()
+	if r.data != nil && r.last == i {
+		data := r.data
+		r.mu.Unlock()
+		return data, nil
+	}
+	r.mu.Unlock()
+
+	block := r.index.blocks[i]
+	data, err := r.archive.cache.get(blockKey{file: r.job.info.Name, index: block.Index}, func() ([]byte, error) {
+		return decodeIndexedBlock(blockJob{file: r.job, block: block}, r.archive.decode)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Cached buffers are never reused, so holding on to one is safe
+	r.mu.Lock()
+	r.last, r.data = i, data
+	r.mu.Unlock()
+	return data, nil
+}
+
+// decodeIndexedBlock decodes a block and checks that it produced as many
+// bytes as the index expects, so offsets computed from the index stay valid
+func decodeIndexedBlock(job blockJob, decode decodeFunc) ([]byte, error) {
+	data, err := decodeBlock(job, decode)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != job.block.Header.ProcessedSize {
+		putBuffer(data)
+		return nil, &DecompressError{Block: job.block.Index, Err: fmt.Errorf("decoded %d bytes, header says %d",
+			len(data), job.block.Header.ProcessedSize)}
+	}
+	return data, nil
+}
+
+// blockKey identifies a decoded block in a blockCache
+type blockKey struct {
+	file  string
+	index int
+}
+
+// cachedBlock is a decoded block, or one still being decoded
+type cachedBlock struct {
+	key   blockKey
+	ready chan struct{} // Closed once data or err is set
+	data  []byte
+	err   error
+	elem  *list.Element
+}
+
+// blockCache is a small LRU of decoded blocks. Concurrent reads of the same
+// block wait for one decode instead of repeating it. Cached buffers are never
+// returned to the buffer pool, since a reader may still be copying from them.
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int
+	lru      *list.List // Most recently used first
+	entries  map[blockKey]*cachedBlock
+}
+
+// newBlockCache creates a cache holding up to capacity blocks
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[blockKey]*cachedBlock),
+	}
+}
+
+// get returns the cached block for key, calling decode on a miss. Failed
+// decodes are not cached.
+func (c *blockCache) get(key blockKey, decode func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(entry.elem)
+		c.mu.Unlock()
+		<-entry.ready
+		return entry.data, entry.err
+	}
+
+	entry := &cachedBlock{key: key, ready: make(chan struct{})}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[key] = entry
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Remove(c.lru.Back()).(*cachedBlock)
+		delete(c.entries, oldest.key)
+	}
+	c.mu.Unlock()
+
+	entry.data, entry.err = decode()
+	close(entry.ready)
+
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == entry {
+			c.lru.Remove(entry.elem)
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	return entry.data, entry.err
+}
@@ -0,0 +1,65 @@
+package extractor
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPartitionReaderKeepsBlock(t *testing.T) {
+	files := testFiles()
+	archive := openTestArchive(t, files)
+
+	// A one-block cache that two readers keep evicting from each other
+	archive.cache = newBlockCache(1)
+	var decodes atomic.Int64
+	decode := archive.decode
+	archive.decode = func(compressedData, out []byte, dictSize uint32) error {
+		decodes.Add(1)
+		return decode(compressedData, out, dictSize)
+	}
+
+	file, _ := archive.Lookup("boot.img")
+	var readers [2]*io.SectionReader
+	var outputs [2]bytes.Buffer
+	for i := range readers {
+		r, err := archive.OpenPartition(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers[i] = io.NewSectionReader(r, 0, r.Size())
+	}
+
+	// Interleave small sequential reads, the second reader one block behind
+	chunk := make([]byte, 8<<10)
+	for done := 0; done < len(readers); {
+		done = 0
+		for i, r := range readers {
+			if i == 1 && outputs[0].Len() < len(files[0].Data)/2 {
+				continue
+			}
+			n, err := r.Read(chunk)
+			outputs[i].Write(chunk[:n])
+			if err == io.EOF {
+				done++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := range outputs {
+		if !bytes.Equal(outputs[i].Bytes(), files[0].Data) {
+			t.Errorf("reader %d: read %d bytes that differ from the partition", i, outputs[i].Len())
+		}
+	}
+	index, err := archive.index(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := len(index.blocks)
+	if n := decodes.Load(); n != int64(2*blocks) {
+		t.Errorf("decoded %d blocks for two readers of %d blocks, want %d", n, blocks, 2*blocks)
+	}
+}
@@ -0,0 +1,222 @@
+// Package extractor - Reporter interface for Stage 2 events and output
+package extractor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
+)
+
+// ExtractionInfo describes a Stage 2 run once its inputs are loaded
+type ExtractionInfo struct {
+	Workers     int
+	MaxMemory   uint64
+	Decoder     string
+	Files       []parser.FileInfo
+	Region6Size uint64
+	TotalSize   uint64 // Sum of PartitionLength
+}
+
+// Summary is the outcome of a Stage 2 run
+type Summary struct {
+	Results   []FileResult // In FileIndex order
+	Succeeded int
+	Duration  time.Duration
+	Stats     *Stats
+}
+
+// Failed returns the results of the files that failed
+func (s *Summary) Failed() []FileResult {
+	var failed []FileResult
+	for _, result := range s.Results {
+		if !result.Success {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Reporter receives everything the parser and extractor want to show. The
+// file and block callbacks are made from worker goroutines, so
+// implementations must be safe for concurrent use.
+type Reporter interface {
+	parser.Reporter
+
+	// ExtractionStarted is called once Stage 2 has loaded its inputs
+	ExtractionStarted(info ExtractionInfo)
+	// FileQueued is called for every file before any of its blocks are decoded
+	FileQueued(file parser.FileInfo)
+	// BlockDecoded is called after a block has been decrypted and decompressed
+	BlockDecoded(file parser.FileInfo, block int, size int)
+	// FileProgress is called as a file's output grows to written bytes
+	FileProgress(file parser.FileInfo, written int64)
+	// FileDone is called once a file has been verified or has failed
+	FileDone(file parser.FileInfo, result FileResult)
+	// ExtractionDone is called with the results of all files
+	ExtractionDone(summary *Summary)
+}
+
+// SilentReporter discards all events. It is used when Options.Reporter is nil.
+type SilentReporter struct{}
+
+var _ Reporter = SilentReporter{}
+
+func (SilentReporter) Debugf(string, ...any)                      {}
+func (SilentReporter) Verbosef(string, ...any)                    {}
+func (SilentReporter) Infof(string, ...any)                       {}
+func (SilentReporter) Warnf(string, ...any)                       {}
+func (SilentReporter) Errorf(string, ...any)                      {}
+func (SilentReporter) ArchiveOpened(parser.ArchiveInfo)           {}
+func (SilentReporter) RegionFound(parser.RegionInfo)              {}
+func (SilentReporter) RegionSaved(parser.RegionInfo, string, int) {}
+func (SilentReporter) ArchiveParsed(int)                          {}
+func (SilentReporter) ExtractionStarted(ExtractionInfo)           {}
+func (SilentReporter) FileQueued(parser.FileInfo)                 {}
+func (SilentReporter) BlockDecoded(parser.FileInfo, int, int)     {}
+func (SilentReporter) FileProgress(parser.FileInfo, int64)        {}
+func (SilentReporter) FileDone(parser.FileInfo, FileResult)       {}
+func (SilentReporter) ExtractionDone(*Summary)                    {}
+
+// multiReporter forwards every event to several reporters in order
+type multiReporter []Reporter
+
+// MultiReporter returns a Reporter that forwards every call to all of reporters
+func MultiReporter(reporters ...Reporter) Reporter {
+	return multiReporter(reporters)
+}
+
+func (m multiReporter) Debugf(format string, args ...any) {
+	for _, r := range m {
+		r.Debugf(format, args...)
+	}
+}
+
+func (m multiReporter) Verbosef(format string, args ...any) {
+	for _, r := range m {
+		r.Verbosef(format, args...)
+	}
+}
+
+func (m multiReporter) Infof(format string, args ...any) {
+	for _, r := range m {
+		r.Infof(format, args...)
+	}
+}
+
+func (m multiReporter) Warnf(format string, args ...any) {
+	for _, r := range m {
+		r.Warnf(format, args...)
+	}
+}
+
+func (m multiReporter) Errorf(format string, args ...any) {
+	for _, r := range m {
+		r.Errorf(format, args...)
+	}
+}
+
+func (m multiReporter) ArchiveOpened(info parser.ArchiveInfo) {
+	for _, r := range m {
+		r.ArchiveOpened(info)
+	}
+}
+
+func (m multiReporter) RegionFound(region parser.RegionInfo) {
+	for _, r := range m {
+		r.RegionFound(region)
+	}
+}
+
+func (m multiReporter) RegionSaved(region parser.RegionInfo, path string, size int) {
+	for _, r := range m {
+		r.RegionSaved(region, path, size)
+	}
+}
+
+func (m multiReporter) ArchiveParsed(regions int) {
+	for _, r := range m {
+		r.ArchiveParsed(regions)
+	}
+}
+
+func (m multiReporter) ExtractionStarted(info ExtractionInfo) {
+	for _, r := range m {
+		r.ExtractionStarted(info)
+	}
+}
+
+func (m multiReporter) FileQueued(file parser.FileInfo) {
+	for _, r := range m {
+		r.FileQueued(file)
+	}
+}
+
+func (m multiReporter) BlockDecoded(file parser.FileInfo, block int, size int) {
+	for _, r := range m {
+		r.BlockDecoded(file, block, size)
+	}
+}
+
+func (m multiReporter) FileProgress(file parser.FileInfo, written int64) {
+	for _, r := range m {
+		r.FileProgress(file, written)
+	}
+}
+
+func (m multiReporter) FileDone(file parser.FileInfo, result FileResult) {
+	for _, r := range m {
+		r.FileDone(file, result)
+	}
+}
+
+func (m multiReporter) ExtractionDone(summary *Summary) {
+	for _, r := range m {
+		r.ExtractionDone(summary)
+	}
+}
+
+// fileTracker maps files to progress renderer tasks for the reporters that
+// display progress
+type fileTracker struct {
+	mu       sync.Mutex
+	renderer *progress.Renderer
+	tasks    map[string]*progress.Task
+}
+
+// start begins tracking with renderer
+func (t *fileTracker) start(renderer *progress.Renderer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.renderer = renderer
+	t.tasks = make(map[string]*progress.Task)
+}
+
+// queue registers a file with the renderer
+func (t *fileTracker) queue(file parser.FileInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.renderer != nil {
+		t.tasks[file.Name] = t.renderer.AddFile(file.Name, int64(file.PartitionLength))
+	}
+}
+
+// task returns the renderer task of a file (nil if it is not tracked)
+func (t *fileTracker) task(file parser.FileInfo) *progress.Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tasks[file.Name]
+}
+
+// stop stops the renderer, printing its final state
+func (t *fileTracker) stop() {
+	t.mu.Lock()
+	renderer := t.renderer
+	t.renderer = nil
+	t.mu.Unlock()
+
+	if renderer != nil {
+		renderer.Stop()
+	}
+}
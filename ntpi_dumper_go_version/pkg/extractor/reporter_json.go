@@ -0,0 +1,125 @@
+// Package extractor - NDJSON reporter for GUI front-ends
+package extractor
+
+import (
+	"fmt"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
+)
+
+// JSONReporter writes every event to an NDJSON stream. Warnings and errors
+// become "log" events; debug and info messages are left to other reporters.
+type JSONReporter struct {
+	events *progress.EventWriter
+	files  fileTracker
+}
+
+var _ Reporter = (*JSONReporter)(nil)
+
+// NewJSONReporter creates a reporter emitting to events
+func NewJSONReporter(events *progress.EventWriter) *JSONReporter {
+	return &JSONReporter{events: events}
+}
+
+// archiveEvent is the payload of the "archive" event
+type archiveEvent struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Version   string `json:"version"`
+	Supported bool   `json:"supported"`
+}
+
+// logEvent is the payload of the "log" event
+type logEvent struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// summaryEvent is the payload of the final "summary" event
+type summaryEvent struct {
+	OK          bool     `json:"ok"`
+	FilesTotal  int      `json:"files_total"`
+	FilesOK     int      `json:"files_ok"`
+	FailedFiles []string `json:"failed_files"`
+	DurationMS  int64    `json:"duration_ms"`
+	Stats       *Stats   `json:"stats"`
+}
+
+// Debugf is not emitted
+func (j *JSONReporter) Debugf(format string, args ...any) {}
+
+// Verbosef is not emitted
+func (j *JSONReporter) Verbosef(format string, args ...any) {}
+
+// Infof is not emitted
+func (j *JSONReporter) Infof(format string, args ...any) {}
+
+// Warnf emits a "log" event at warn level
+func (j *JSONReporter) Warnf(format string, args ...any) {
+	j.events.Emit("log", logEvent{Level: logging.LevelWarn.String(), Message: fmt.Sprintf(format, args...)})
+}
+
+// Errorf emits a "log" event at error level
+func (j *JSONReporter) Errorf(format string, args ...any) {
+	j.events.Emit("log", logEvent{Level: logging.LevelError.String(), Message: fmt.Sprintf(format, args...)})
+}
+
+// ArchiveOpened emits "archive"
+func (j *JSONReporter) ArchiveOpened(info parser.ArchiveInfo) {
+	j.events.Emit("archive", archiveEvent{Path: info.Path, Size: info.Size, Version: info.Version, Supported: info.Supported})
+}
+
+// RegionFound emits "region"
+func (j *JSONReporter) RegionFound(region parser.RegionInfo) {
+	j.events.Emit("region", progress.RegionEvent{Region: region.Name, Type: region.Type, Size: region.Size})
+}
+
+// RegionSaved is not emitted
+func (j *JSONReporter) RegionSaved(region parser.RegionInfo, path string, size int) {}
+
+// ArchiveParsed is not emitted; the caller reports the end of Stage 1
+func (j *JSONReporter) ArchiveParsed(regions int) {}
+
+// ExtractionStarted starts emitting file and "progress" events
+func (j *JSONReporter) ExtractionStarted(info ExtractionInfo) {
+	j.files.start(progress.NewJSON(j.events, int64(info.TotalSize), len(info.Files)))
+}
+
+// FileQueued emits "file_queued"
+func (j *JSONReporter) FileQueued(file parser.FileInfo) {
+	j.files.queue(file)
+}
+
+// BlockDecoded is not emitted
+func (j *JSONReporter) BlockDecoded(file parser.FileInfo, block int, size int) {}
+
+// FileProgress emits "file_started" for the first bytes and feeds "progress"
+func (j *JSONReporter) FileProgress(file parser.FileInfo, written int64) {
+	j.files.task(file).Set(written)
+}
+
+// FileDone emits "file_done"
+func (j *JSONReporter) FileDone(file parser.FileInfo, result FileResult) {
+	j.files.task(file).Finish(result.Err)
+}
+
+// ExtractionDone emits the final "progress" and "summary" events
+func (j *JSONReporter) ExtractionDone(summary *Summary) {
+	j.files.stop()
+
+	failedFiles := []string{}
+	for _, result := range summary.Failed() {
+		failedFiles = append(failedFiles, result.FileName)
+	}
+
+	j.events.Emit("summary", summaryEvent{
+		OK:          summary.Succeeded == len(summary.Results),
+		FilesTotal:  len(summary.Results),
+		FilesOK:     summary.Succeeded,
+		FailedFiles: failedFiles,
+		DurationMS:  summary.Duration.Milliseconds(),
+		Stats:       summary.Stats,
+	})
+}
@@ -0,0 +1,149 @@
+// Package extractor - Recording reporter for tests
+package extractor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+// RecordedEvent is one callback received by a Recorder
+type RecordedEvent struct {
+	Kind   string // Callback name, e.g. "FileDone" or "Warnf"
+	Name   string // File or region name, if any
+	Detail string // Formatted message or other details
+}
+
+// Recorder is a Reporter that records every callback so tests can assert on
+// what the parser and extractor reported. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	events  []RecordedEvent
+	results []FileResult
+	summary *Summary
+}
+
+var _ Reporter = (*Recorder)(nil)
+
+// record appends an event
+func (r *Recorder) record(kind, name, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, RecordedEvent{Kind: kind, Name: name, Detail: detail})
+}
+
+// Events returns a copy of all recorded events in order
+func (r *Recorder) Events() []RecordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedEvent(nil), r.events...)
+}
+
+// Count returns how many events of kind were recorded
+func (r *Recorder) Count(kind string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, event := range r.events {
+		if event.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Results returns the FileDone results in the order they arrived
+func (r *Recorder) Results() []FileResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]FileResult(nil), r.results...)
+}
+
+// Summary returns the summary passed to ExtractionDone (nil before that)
+func (r *Recorder) Summary() *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.summary
+}
+
+// Debugf records a "Debugf" event
+func (r *Recorder) Debugf(format string, args ...any) {
+	r.record("Debugf", "", fmt.Sprintf(format, args...))
+}
+
+// Verbosef records a "Verbosef" event
+func (r *Recorder) Verbosef(format string, args ...any) {
+	r.record("Verbosef", "", fmt.Sprintf(format, args...))
+}
+
+// Infof records an "Infof" event
+func (r *Recorder) Infof(format string, args ...any) {
+	r.record("Infof", "", fmt.Sprintf(format, args...))
+}
+
+// Warnf records a "Warnf" event
+func (r *Recorder) Warnf(format string, args ...any) {
+	r.record("Warnf", "", fmt.Sprintf(format, args...))
+}
+
+// Errorf records an "Errorf" event
+func (r *Recorder) Errorf(format string, args ...any) {
+	r.record("Errorf", "", fmt.Sprintf(format, args...))
+}
+
+// ArchiveOpened records the archive version
+func (r *Recorder) ArchiveOpened(info parser.ArchiveInfo) {
+	r.record("ArchiveOpened", info.Path, info.Version)
+}
+
+// RegionFound records the region
+func (r *Recorder) RegionFound(region parser.RegionInfo) {
+	r.record("RegionFound", region.Name, fmt.Sprintf("type=%d size=%d", region.Type, region.Size))
+}
+
+// RegionSaved records where the region was written
+func (r *Recorder) RegionSaved(region parser.RegionInfo, path string, size int) {
+	r.record("RegionSaved", region.Name, fmt.Sprintf("%s (%d bytes)", path, size))
+}
+
+// ArchiveParsed records the region count
+func (r *Recorder) ArchiveParsed(regions int) {
+	r.record("ArchiveParsed", "", fmt.Sprintf("%d regions", regions))
+}
+
+// ExtractionStarted records the file count and workers
+func (r *Recorder) ExtractionStarted(info ExtractionInfo) {
+	r.record("ExtractionStarted", "", fmt.Sprintf("%d files, %d workers", len(info.Files), info.Workers))
+}
+
+// FileQueued records the file
+func (r *Recorder) FileQueued(file parser.FileInfo) {
+	r.record("FileQueued", file.Name, "")
+}
+
+// BlockDecoded records the block index and size
+func (r *Recorder) BlockDecoded(file parser.FileInfo, block int, size int) {
+	r.record("BlockDecoded", file.Name, fmt.Sprintf("block %d (%d bytes)", block, size))
+}
+
+// FileProgress records the bytes written so far
+func (r *Recorder) FileProgress(file parser.FileInfo, written int64) {
+	r.record("FileProgress", file.Name, fmt.Sprintf("%d", written))
+}
+
+// FileDone records the result
+func (r *Recorder) FileDone(file parser.FileInfo, result FileResult) {
+	r.mu.Lock()
+	r.results = append(r.results, result)
+	r.mu.Unlock()
+	r.record("FileDone", file.Name, result.Message)
+}
+
+// ExtractionDone records the summary
+func (r *Recorder) ExtractionDone(summary *Summary) {
+	r.mu.Lock()
+	r.summary = summary
+	r.mu.Unlock()
+	r.record("ExtractionDone", "", fmt.Sprintf("%d of %d succeeded", summary.Succeeded, len(summary.Results)))
+}
@@ -0,0 +1,151 @@
+// Package extractor - Terminal reporter (colored log output, progress on stderr)
+package extractor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/progress"
+	"github.com/fatih/color"
+)
+
+// TerminalOptions configures a TerminalReporter
+type TerminalOptions struct {
+	Logger   logging.Logger // Receives all text output (default: info level on stdout)
+	Progress progress.Mode  // Progress display on stderr
+	Stats    bool           // Print the per-phase statistics table at the end
+}
+
+// TerminalReporter logs the familiar colored output of the CLI and drives
+// the progress renderer. Headings and summaries are logged at info level, so
+// a logger at error level leaves only failures.
+type TerminalReporter struct {
+	logging.Logger
+	opts  TerminalOptions
+	files fileTracker
+}
+
+var _ Reporter = (*TerminalReporter)(nil)
+
+// NewTerminalReporter creates a TerminalReporter
+func NewTerminalReporter(opts TerminalOptions) *TerminalReporter {
+	if opts.Logger == nil {
+		opts.Logger = logging.NewLogger(os.Stdout, logging.LevelInfo)
+	}
+	return &TerminalReporter{Logger: opts.Logger, opts: opts}
+}
+
+// ArchiveOpened prints the Stage 1 heading and archive details
+func (t *TerminalReporter) ArchiveOpened(info parser.ArchiveInfo) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+
+	t.Infof("%s", cyan("=== Stage 1: Parsing NTPI File ==="))
+	t.Infof("File size: %s", cyan(fmt.Sprintf("%.2f MB", float64(info.Size)/(1024*1024))))
+	t.Infof("NTPI Version: %s", green(info.Version))
+}
+
+// RegionFound prints the region being processed
+func (t *TerminalReporter) RegionFound(region parser.RegionInfo) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+
+	t.Infof("\n%s %s (Type=%d, Size=%d bytes)",
+		cyan("Processing Region:"), green(region.Name), region.Type, region.Size)
+}
+
+// RegionSaved prints where a region was written
+func (t *TerminalReporter) RegionSaved(region parser.RegionInfo, path string, size int) {
+	if region.Type == 6 {
+		t.Infof("  Saved to: %s", path)
+		return
+	}
+	t.Infof("  Saved to: %s (%.2f KB)", path, float64(size)/1024)
+}
+
+// ArchiveParsed prints the Stage 1 result
+func (t *TerminalReporter) ArchiveParsed(regions int) {
+	green := color.New(color.FgGreen).SprintFunc()
+	t.Infof("\n%s", green(fmt.Sprintf("Successfully extracted %d regions", regions)))
+}
+
+// ExtractionStarted prints the Stage 2 setup and starts the progress display
+func (t *TerminalReporter) ExtractionStarted(info ExtractionInfo) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	t.Infof("\n%s", cyan("=== Stage 2: Extracting and Decompressing Files ==="))
+	t.Infof("Worker goroutines: %s", cyan(fmt.Sprintf("%d", info.Workers)))
+	t.Infof("Memory budget: %s", cyan(formatSize(info.MaxMemory)))
+	t.Infof("Decoder: %s", cyan(info.Decoder))
+	t.Infof("Total files: %s", cyan(fmt.Sprintf("%d", len(info.Files))))
+	t.Infof("Region6 size: %s", cyan(fmt.Sprintf("%.2f MB", float64(info.Region6Size)/(1024*1024))))
+	t.Infof("Total data size: %s\n", cyan(fmt.Sprintf("%.2f GB", float64(info.TotalSize)/(1024*1024*1024))))
+
+	// Print all partitions with their sizes
+	t.Infof("Found partitions:")
+	for _, file := range info.Files {
+		t.Infof("%s (%s)", file.Name, formatSize(file.PartitionLength))
+	}
+	t.Infof("")
+
+	t.files.start(progress.New(os.Stderr, t.opts.Progress, int64(info.TotalSize), len(info.Files)))
+}
+
+// FileQueued adds the file to the progress display
+func (t *TerminalReporter) FileQueued(file parser.FileInfo) {
+	t.files.queue(file)
+}
+
+// BlockDecoded is not shown on the terminal
+func (t *TerminalReporter) BlockDecoded(file parser.FileInfo, block int, size int) {}
+
+// FileProgress updates the file's progress line
+func (t *TerminalReporter) FileProgress(file parser.FileInfo, written int64) {
+	t.files.task(file).Set(written)
+}
+
+// FileDone marks the file as finished in the progress display
+func (t *TerminalReporter) FileDone(file parser.FileInfo, result FileResult) {
+	t.files.task(file).Finish(result.Err)
+	if result.Success {
+		t.Verbosef("Verified %s (%s) in %s", file.Name, formatSize(file.PartitionLength), result.Duration.Round(time.Millisecond))
+	}
+}
+
+// ExtractionDone stops the progress display and prints the summary
+func (t *TerminalReporter) ExtractionDone(summary *Summary) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	t.files.stop()
+
+	failed := summary.Failed()
+	for _, result := range failed {
+		t.Errorf("%s: %s", result.FileName, result.Message)
+	}
+
+	total := len(summary.Results)
+	t.Infof("\n%s", cyan("=== Extraction Summary ==="))
+	t.Infof("Successful: %s / %d", green(fmt.Sprintf("%d", summary.Succeeded)), total)
+	if len(failed) > 0 {
+		t.Infof("Failed: %s", red(fmt.Sprintf("%d", len(failed))))
+		for _, result := range failed {
+			t.Infof("  - %s", result.FileName)
+		}
+	}
+	t.Infof("Total time: %s (%.2f seconds / %.2f minutes, %.2f files/sec)",
+		cyan(summary.Duration.Round(time.Second).String()),
+		summary.Duration.Seconds(), summary.Duration.Minutes(),
+		float64(total)/summary.Duration.Seconds())
+
+	if t.opts.Stats && summary.Stats != nil {
+		var b strings.Builder
+		summary.Stats.Fprint(&b)
+		t.Infof("%s", b.String())
+	}
+}
@@ -0,0 +1,131 @@
+// Package extractor - Largest-first block scheduling with adaptive segments
+package extractor
+
+import (
+	"sort"
+	"sync"
+)
+
+// blockScheduler decides which file's next block is fed to the pool.
+//
+// Files are started in descending size order (longest-processing-time first),
+// and each file may only have a limited number of blocks in flight: its
+// "segments". A file's segment count is its share of the workers in proportion
+// to its share of the remaining work, recomputed as work completes. Large files
+// therefore start first with the most parallelism, small files fill in around
+// them, and whichever file is left at the end gets every worker.
+type blockScheduler struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	workers     int
+	maxSegments int        // Cap on any file's segments (0 = workers)
+	files       []*fileJob // Largest first
+
+	undispatched uint64 // Decompressed bytes not yet dispatched, across all files
+}
+
+// newBlockScheduler orders files largest first. Nil entries (files that could
+// not be enumerated) are skipped.
+func newBlockScheduler(jobs []*fileJob, workers, maxSegments int) *blockScheduler {
+	s := &blockScheduler{workers: workers, maxSegments: maxSegments}
+	s.cond = sync.NewCond(&s.mu)
+
+	for _, job := range jobs {
+		if job == nil {
+			continue
+		}
+		job.scheduler = s
+		s.files = append(s.files, job)
+		s.undispatched += job.undispatch
+	}
+
+	sort.SliceStable(s.files, func(i, j int) bool {
+		return s.files[i].info.PartitionLength > s.files[j].info.PartitionLength
+	})
+
+	return s
+}
+
+// segmentLimit returns how many blocks of a file may be in flight at once:
+// the file's share of the workers in proportion to its share of the
+// remaining work, rounded up and clamped to [1, workers]. A positive
+// maxSegments lowers the upper bound.
+func segmentLimit(workers, maxSegments int, fileRemaining, totalRemaining uint64) int {
+	limit := workers
+	if maxSegments > 0 && maxSegments < limit {
+		limit = maxSegments
+	}
+	if totalRemaining == 0 || fileRemaining >= totalRemaining {
+		return limit
+	}
+
+	share := (uint64(workers)*fileRemaining + totalRemaining - 1) / totalRemaining
+	switch {
+	case share < 1:
+		return 1
+	case share > uint64(limit):
+		return limit
+	default:
+		return int(share)
+	}
+}
+
+// feed dispatches every block of every file to the pool
+func (s *blockScheduler) feed(pool *blockPool) {
+	for {
+		job, block, ok := s.next()
+		if !ok {
+			return
+		}
+		pool.submit(blockJob{file: job, block: block})
+	}
+}
+
+// next picks the block to dispatch, waiting while every file with blocks left
+// is at its segment limit. It returns false once all blocks are dispatched.
+func (s *blockScheduler) next() (*fileJob, blockRef, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		var best *fileJob
+		pending := false
+
+		for _, job := range s.files {
+			if job.nextBlock >= len(job.blocks) {
+				continue
+			}
+			pending = true
+
+			if job.inFlight >= segmentLimit(s.workers, s.maxSegments, job.undispatch, s.undispatched) {
+				continue
+			}
+			// Files are sorted largest first, so ties keep that order
+			if best == nil || job.undispatch > best.undispatch {
+				best = job
+			}
+		}
+
+		if best != nil {
+			block := best.blocks[best.nextBlock]
+			best.nextBlock++
+			best.inFlight++
+			best.undispatch -= block.Header.ProcessedSize
+			s.undispatched -= block.Header.ProcessedSize
+			return best, block, true
+		}
+
+		if !pending {
+			return nil, blockRef{}, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// done records that a writer has received one of its file's blocks
+func (s *blockScheduler) done(job *fileJob) {
+	s.mu.Lock()
+	job.inFlight--
+	s.mu.Unlock()
+	s.cond.Signal()
+}
@@ -0,0 +1,30 @@
+package extractor
+
+import "testing"
+
+func TestSegmentLimit(t *testing.T) {
+	tests := []struct {
+		workers, maxSegments int
+		file, total          uint64
+		want                 int
+	}{
+		{8, 0, 100, 100, 8},  // Last file gets every worker
+		{8, 0, 0, 0, 8},      // Nothing left
+		{8, 0, 50, 100, 4},   // Half the work, half the workers
+		{8, 0, 1, 3, 3},      // Rounded up
+		{8, 0, 1, 1000, 1},   // Never below one
+		{8, 0, 0, 1000, 1},   // Even with nothing left to dispatch
+		{8, 0, 999, 1000, 8}, // Never above the workers
+		{1, 0, 10, 100, 1},
+		{8, 2, 50, 100, 2},   // Capped
+		{8, 2, 100, 100, 2},  // Capped for the last file too
+		{8, 2, 1, 1000, 1},   // The cap does not raise the share
+		{4, 16, 100, 100, 4}, // A cap above the workers changes nothing
+	}
+	for _, tt := range tests {
+		if got := segmentLimit(tt.workers, tt.maxSegments, tt.file, tt.total); got != tt.want {
+			t.Errorf("segmentLimit(%d, %d, %d, %d) = %d, want %d",
+				tt.workers, tt.maxSegments, tt.file, tt.total, got, tt.want)
+		}
+	}
+}
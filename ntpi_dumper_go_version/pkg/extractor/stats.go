@@ -0,0 +1,204 @@
+// Package extractor - Per-stage timing and throughput statistics
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// phase identifies one stage of the per-block pipeline
+type phase int
+
+const (
+	phaseRead       phase = iota // Reading the encrypted payload from Region6
+	phaseKeyLookup               // Looking up the block's AES cipher
+	phaseDecrypt                 // AES-CBC decryption
+	phaseDecompress              // LZMA2 decompression
+	phaseHash                    // SHA-256 of the output
+	phaseWrite                   // Writing and syncing the output file
+	numPhases
+)
+
+// phaseNames are the names used in the statistics table and JSON output
+var phaseNames = [numPhases]string{"read", "key lookup", "decrypt", "decompress", "hash", "write"}
+
+// phaseTimer accumulates time and bytes per phase. Workers decoding blocks of
+// the same file update it concurrently.
+type phaseTimer struct {
+	nanos [numPhases]atomic.Int64
+	bytes [numPhases]atomic.Uint64
+}
+
+// add records that p processed n bytes since start
+func (t *phaseTimer) add(p phase, start time.Time, n int) {
+	t.nanos[p].Add(int64(time.Since(start)))
+	t.bytes[p].Add(uint64(n))
+}
+
+// snapshot returns the accumulated totals
+func (t *phaseTimer) snapshot() []PhaseStats {
+	phases := make([]PhaseStats, numPhases)
+	for p := range phases {
+		phases[p] = PhaseStats{
+			Phase:    phaseNames[p],
+			Duration: time.Duration(t.nanos[p].Load()),
+			Bytes:    t.bytes[p].Load(),
+		}
+	}
+	return phases
+}
+
+// PhaseStats is the time spent and data processed in one pipeline phase.
+// Durations are summed over all workers, so they can exceed wall time.
+type PhaseStats struct {
+	Phase    string        `json:"phase"`
+	Duration time.Duration `json:"duration_ns"`
+	Bytes    uint64        `json:"bytes"`
+}
+
+// Throughput returns bytes per second of busy time (0 when nothing was timed)
+func (p PhaseStats) Throughput() float64 {
+	if p.Duration <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Duration.Seconds()
+}
+
+// FileStats holds the phase breakdown for one partition (or the total)
+type FileStats struct {
+	Name             string       `json:"name"`
+	Blocks           int          `json:"blocks"`
+	CompressedSize   uint64       `json:"compressed_bytes"`   // Sum of block OriginalSize
+	DecompressedSize uint64       `json:"decompressed_bytes"` // Sum of block ProcessedSize
+	Phases           []PhaseStats `json:"phases"`
+}
+
+// Ratio returns the compression ratio (decompressed / compressed)
+func (f *FileStats) Ratio() float64 {
+	if f.CompressedSize == 0 {
+		return 0
+	}
+	return float64(f.DecompressedSize) / float64(f.CompressedSize)
+}
+
+// busy returns the total time spent in all phases
+func (f *FileStats) busy() time.Duration {
+	total := time.Duration(0)
+	for _, p := range f.Phases {
+		total += p.Duration
+	}
+	return total
+}
+
+// Stats is the per-stage breakdown of a Stage 2 run
+type Stats struct {
+	Files    []*FileStats  `json:"files"`
+	Total    FileStats     `json:"total"`
+	WallTime time.Duration `json:"wall_time_ns"`
+}
+
+// newFileStats collects the statistics of a file once all its blocks are done
+func newFileStats(f *fileJob) *FileStats {
+	stats := &FileStats{
+		Name:   f.info.Name,
+		Blocks: len(f.blocks),
+		Phases: f.timing.snapshot(),
+	}
+	for _, block := range f.blocks {
+		stats.CompressedSize += block.Header.OriginalSize
+		stats.DecompressedSize += block.Header.ProcessedSize
+	}
+	return stats
+}
+
+// newStats sums the statistics of every file that got as far as Stage 2
+func newStats(results []FileResult, wallTime time.Duration) *Stats {
+	stats := &Stats{
+		Total: FileStats{
+			Name:   "total",
+			Phases: make([]PhaseStats, numPhases),
+		},
+		WallTime: wallTime,
+	}
+	for p := range stats.Total.Phases {
+		stats.Total.Phases[p].Phase = phaseNames[p]
+	}
+
+	for _, result := range results {
+		if result.Stats == nil {
+			continue
+		}
+		file := result.Stats
+		stats.Files = append(stats.Files, file)
+		stats.Total.Blocks += file.Blocks
+		stats.Total.CompressedSize += file.CompressedSize
+		stats.Total.DecompressedSize += file.DecompressedSize
+		for p := range file.Phases {
+			stats.Total.Phases[p].Duration += file.Phases[p].Duration
+			stats.Total.Phases[p].Bytes += file.Phases[p].Bytes
+		}
+	}
+
+	return stats
+}
+
+// Fprint writes the statistics tables to w
+func (s *Stats) Fprint(w io.Writer) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	fmt.Fprintf(w, "\n%s\n", cyan("=== Statistics ==="))
+	fmt.Fprintf(w, "Wall time: %s, busy time: %s (summed over workers)\n",
+		formatDuration(s.WallTime), formatDuration(s.Total.busy()))
+	fmt.Fprintf(w, "Compressed: %s, decompressed: %s (ratio %.2fx)\n\n",
+		formatSize(s.Total.CompressedSize), formatSize(s.Total.DecompressedSize), s.Total.Ratio())
+
+	// Totals per phase
+	busy := s.Total.busy()
+	fmt.Fprintf(w, "%-12s %10s %7s %10s %12s\n", "Phase", "Time", "Share", "Bytes", "Throughput")
+	for _, p := range s.Total.Phases {
+		share := 0.0
+		if busy > 0 {
+			share = 100 * float64(p.Duration) / float64(busy)
+		}
+		fmt.Fprintf(w, "%-12s %10s %6.1f%% %10s %12s\n", p.Phase, formatDuration(p.Duration), share,
+			formatSize(p.Bytes), formatThroughput(p.Throughput()))
+	}
+
+	// Time per phase for every partition
+	fmt.Fprintf(w, "\n%-24s %10s %6s", "Partition", "Size", "Ratio")
+	for _, name := range phaseNames {
+		fmt.Fprintf(w, " %10s", name)
+	}
+	fmt.Fprintln(w)
+	for _, file := range append(s.Files, &s.Total) {
+		fmt.Fprintf(w, "%-24s %10s %5.2fx", truncateFileName(file.Name, 24), formatSize(file.DecompressedSize), file.Ratio())
+		for _, p := range file.Phases {
+			fmt.Fprintf(w, " %10s", formatDuration(p.Duration))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// formatDuration formats a duration with a precision suited to its size
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	}
+}
+
+// formatThroughput formats bytes per second
+func formatThroughput(bytesPerSec float64) string {
+	if bytesPerSec <= 0 {
+		return "-"
+	}
+	return formatSize(uint64(bytesPerSec)) + "/s"
+}
@@ -2,56 +2,109 @@
 package extractor
 
 import (
-	"bytes"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
-	"sync"
 	"time"
 
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
-	"github.com/fatih/color"
-	"github.com/schollz/progressbar/v3"
 )
 
-// FileTask represents a file extraction task
-type FileTask struct {
-	FileInfo     parser.FileInfo
-	Region6Data  []byte
-	KeyMapData   []byte
-	OutputDir    string
-	UseSegmented bool
-	NumSegments  int
-	ShowProgress bool // Whether to show per-file progress bar
-}
-
 // FileResult represents the result of a file extraction
 type FileResult struct {
 	FileName string
 	Success  bool
 	Message  string
+	Err      error // Set when Success is false
 	Duration time.Duration
+	Stats    *FileStats // Per-phase timing; nil if the file never reached the pool
 }
 
-// ExtractFiles performs Stage 2: concurrent extraction and decompression
-func ExtractFiles(tempDir, outputDir string, numWorkers int) error {
-	cyan := color.New(color.FgCyan).SprintFunc()
-	green := color.New(color.FgGreen).SprintFunc()
-	red := color.New(color.FgRed).SprintFunc()
+// Options configures Stage 2 extraction
+type Options struct {
+	Workers    int      // Number of block decoding goroutines (0 = one per CPU)
+	MaxMemory  uint64   // Budget for in-flight decompressed data in bytes (0 = auto)
+	Decoder    Decoder  // LZMA2 implementation (DecoderAuto picks liblzma when built with CGO)
+	CrossCheck bool     // Decode every block with both implementations and fail on divergence
+	Reporter   Reporter // Receives progress and results (nil reports nothing)
+	Pool       *Pool    // Shared pool for batch runs; nil starts one for this call from the options above
+	Input      string   // NTPI file the Stage 1 results came from; keys the block index cache
+	IndexCache string   // Directory for cached block indexes ("" disables the cache)
+	DryRun     bool     // Only planning: BuildPlan reads the index cache but does not write it
+	Segments   int      // Most blocks of one file in flight (0 = the file's adaptive share of the workers)
+	Only       []string // Extract only partitions matching one of these patterns (nil = all)
+	Exclude    []string // Skip partitions matching one of these patterns
+}
 
-	fmt.Printf("\n%s\n", cyan("=== Stage 2: Extracting and Decompressing Files ==="))
+// reporter returns the configured Reporter or a silent one
+func (o Options) reporter() Reporter {
+	if o.Reporter == nil {
+		return SilentReporter{}
+	}
+	return o.Reporter
+}
 
-	// Auto-detect optimal worker count if not specified
-	if numWorkers <= 0 {
-		numWorkers = runtime.NumCPU()
-		if numWorkers > 4 {
-			numWorkers = 4 // Cap at 4 for balanced performance
+// selectFiles applies the Only and Exclude patterns. A pattern matches the
+// partition name or its base name, using path.Match syntax. Filters that leave
+// no partition are an error, since they are most likely a typo.
+func (o Options) selectFiles(files []parser.FileInfo) ([]parser.FileInfo, error) {
+	if len(o.Only) == 0 && len(o.Exclude) == 0 {
+		return files, nil
+	}
+
+	var selected []parser.FileInfo
+	for _, file := range files {
+		only, err := matchPartition(o.Only, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		excluded, err := matchPartition(o.Exclude, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		if (len(o.Only) == 0 || only) && !excluded {
+			selected = append(selected, file)
+		}
+	}
+
+	if len(selected) == 0 && len(files) > 0 {
+		return nil, fmt.Errorf("no partition matches the filters (only %q, exclude %q)", o.Only, o.Exclude)
+	}
+	return selected, nil
+}
+
+// matchPartition reports whether name or its base name matches one of patterns
+func matchPartition(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		for _, candidate := range []string{name, path.Base(name)} {
+			matched, err := path.Match(pattern, candidate)
+			if err != nil {
+				return false, fmt.Errorf("invalid partition pattern %q: %w", pattern, err)
+			}
+			if matched {
+				return true, nil
+			}
 		}
 	}
+	return false, nil
+}
 
-	fmt.Printf("Worker goroutines: %s\n", cyan(fmt.Sprintf("%d", numWorkers)))
+// ExtractFiles performs Stage 2: concurrent extraction and decompression
+func ExtractFiles(tempDir, outputDir string, opts Options) error {
+	reporter := opts.reporter()
+
+	pool := opts.Pool
+	if pool == nil {
+		var err error
+		pool, err = NewPool(opts)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+	}
 
 	// Load FileIndex.xml
 	fileIndexPath := filepath.Join(tempDir, "FileIndex.xml")
@@ -59,17 +112,23 @@ func ExtractFiles(tempDir, outputDir string, numWorkers int) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse FileIndex.xml: %w", err)
 	}
+	files, err = opts.selectFiles(files)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("Total files: %s\n", cyan(fmt.Sprintf("%d", len(files))))
-
-	// Load Region6 data
+	// Open Region6 data; blocks are read on demand instead of loading it all
 	region6Path := filepath.Join(tempDir, "region6block.bin")
-	region6Data, err := os.ReadFile(region6Path)
+	region6File, err := os.Open(region6Path)
 	if err != nil {
 		return fmt.Errorf("failed to load Region6 data: %w", err)
 	}
+	defer region6File.Close()
 
-	fmt.Printf("Region6 size: %s\n", cyan(fmt.Sprintf("%.2f MB", float64(len(region6Data))/(1024*1024))))
+	region6Info, err := region6File.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to load Region6 data: %w", err)
+	}
 
 	// Load KeyMap data
 	keyMapPath := filepath.Join(tempDir, "KeyMap.bin")
@@ -83,276 +142,70 @@ func ExtractFiles(tempDir, outputDir string, numWorkers int) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Create tasks
-	tasks := make([]FileTask, len(files))
-	totalSize := uint64(0)
-
-	for i, file := range files {
-		numSegments := calculateOptimalSegments(file.PartitionLength)
-		tasks[i] = FileTask{
-			FileInfo:     file,
-			Region6Data:  region6Data,
-			KeyMapData:   keyMapData,
-			OutputDir:    outputDir,
-			UseSegmented: numSegments > 1,
-			NumSegments:  numSegments,
-			ShowProgress: true, // Enable per-file progress bars
-		}
-		totalSize += file.PartitionLength
+	// Expand every key once instead of per block
+	ciphers, err := crypto.NewCipherCache(keyMapData)
+	if err != nil {
+		return fmt.Errorf("failed to load KeyMap: %w", err)
 	}
 
-	fmt.Printf("Total data size: %s\n\n", cyan(fmt.Sprintf("%.2f GB", float64(totalSize)/(1024*1024*1024))))
-	fmt.Println("Found partitions:")
+	archive := &archiveSource{
+		region6:   region6File,
+		ciphers:   ciphers,
+		index:     openArchiveIndex(opts.IndexCache, opts.Input, reporter),
+		outputDir: outputDir,
+		reporter:  reporter,
+	}
 
-	// Print all partitions with their sizes
+	totalSize := uint64(0)
 	for _, file := range files {
-		sizeStr := formatSize(file.PartitionLength)
-		fmt.Printf("%s (%s)\n", file.Name, sizeStr)
+		totalSize += file.PartitionLength
 	}
-	fmt.Println()
 
-	// Process files with worker pool
+	reporter.ExtractionStarted(ExtractionInfo{
+		Workers:     pool.Workers(),
+		MaxMemory:   pool.maxMemory,
+		Decoder:     pool.decoder,
+		Files:       files,
+		Region6Size: uint64(region6Info.Size()),
+		TotalSize:   totalSize,
+	})
+
+	// Process all blocks of all files through one shared pool
 	startTime := time.Now()
-	results := processFilesParallel(tasks, numWorkers)
+	results := processFiles(archive, files, pool.blocks, opts.Segments)
+	archive.index.save()
 	totalDuration := time.Since(startTime)
 
-	// Analyze results
-	successCount := 0
-	failedFiles := []string{}
-
+	summary := &Summary{
+		Results:  results,
+		Duration: totalDuration,
+		Stats:    newStats(results, totalDuration),
+	}
+	var fileErrors []*FileError
 	for _, result := range results {
 		if result.Success {
-			successCount++
+			summary.Succeeded++
 		} else {
-			failedFiles = append(failedFiles, result.FileName)
-			fmt.Printf("\n%s %s: %s\n", red("Failed"), result.FileName, result.Message)
+			fileErrors = append(fileErrors, &FileError{File: result.FileName, Err: result.Err})
 		}
 	}
 
-	// Print summary
-	fmt.Printf("\n%s\n", cyan("=== Extraction Summary ==="))
-	fmt.Printf("Successful: %s / %d\n", green(fmt.Sprintf("%d", successCount)), len(files))
-	if len(failedFiles) > 0 {
-		fmt.Printf("Failed: %s\n", red(fmt.Sprintf("%d", len(failedFiles))))
-		for _, name := range failedFiles {
-			fmt.Printf("  - %s\n", name)
-		}
-	}
-	totalSeconds := totalDuration.Seconds()
-	totalMinutes := totalDuration.Minutes()
-	fmt.Printf("Total time: %s (%.2f seconds / %.2f minutes, %.2f files/sec)\n",
-		cyan(totalDuration.Round(time.Second).String()),
-		totalSeconds, totalMinutes,
-		float64(len(files))/totalSeconds)
+	reporter.ExtractionDone(summary)
 
-	if successCount != len(files) {
-		return fmt.Errorf("%d files failed to extract", len(failedFiles))
+	if len(fileErrors) > 0 {
+		return &ExtractionError{Failed: fileErrors, Total: len(files)}
 	}
 
 	return nil
 }
 
-// processFilesParallel processes files using a worker pool with per-file progress bars
-func processFilesParallel(tasks []FileTask, numWorkers int) []FileResult {
-	jobs := make(chan FileTask, len(tasks))
-	results := make(chan FileResult, len(tasks))
-
-	var wg sync.WaitGroup
-
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go worker(i, jobs, results, &wg)
-	}
-
-	// Send tasks
-	for _, task := range tasks {
-		jobs <- task
-	}
-	close(jobs)
-
-	// Wait for completion
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	// Collect results
-	var allResults []FileResult
-	for result := range results {
-		allResults = append(allResults, result)
-	}
-
-	return allResults
-}
-
-// worker processes file extraction tasks
-func worker(id int, jobs <-chan FileTask, results chan<- FileResult, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for task := range jobs {
-		startTime := time.Now()
-		var result FileResult
-
-		if task.UseSegmented {
-			// Large file: use segmented parallel processing
-			result = processLargeFileSegmented(task)
-		} else {
-			// Small file: sequential processing
-			result = processFileSequential(task)
-		}
-
-		result.Duration = time.Since(startTime)
-		results <- result
-	}
-}
-
-// Forward declaration - implemented in segment.go
-// processLargeFileSegmented is defined in segment.go
-
-// processFileSequential processes a file sequentially (for files < 500MB)
-func processFileSequential(task FileTask) FileResult {
-	file := task.FileInfo
-	outputPath := filepath.Join(task.OutputDir, file.Name)
-
-	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return FileResult{
-			FileName: file.Name,
-			Success:  false,
-			Message:  fmt.Sprintf("failed to create directory: %v", err),
-		}
-	}
-
-	// Calculate total size and offsets
-	currentOffset := int(file.Offset)
-	endOffset := currentOffset + int(file.Length)
-	totalBytes := int64(file.PartitionLength)
-
-	// Create per-file progress bar (exact payload-dumper-go style)
-	var fileBar *progressbar.ProgressBar
-	if task.ShowProgress {
-		sizeStr := formatSize(file.PartitionLength)
-		// Format: "filename (size) 100% |====| [speed MB/s]"
-		// Align filename to 45 chars for better formatting
-		descStr := fmt.Sprintf("%-45s", fmt.Sprintf("%s (%s)", truncateFileName(file.Name, 30), sizeStr))
-		// Convert bytes to MB for display (divide by 1024*1024)
-		totalMB := totalBytes / (1024 * 1024)
-		if totalMB < 1 {
-			totalMB = 1 // Avoid division by zero for small files
-		}
-		fileBar = progressbar.NewOptions64(totalBytes,
-			progressbar.OptionSetDescription(descStr),
-			progressbar.OptionSetWidth(50),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetPredictTime(false),
-			progressbar.OptionThrottle(100*time.Millisecond),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionSetWriter(os.Stderr),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "=",
-				SaucerHead:    "=",
-				SaucerPadding: " ",
-				BarStart:      "|",
-				BarEnd:        "|",
-			}),
-		)
-	}
-
-	// Process all blocks sequentially
-	var fileData bytes.Buffer
-	blockIndex := 0
-	processedBytes := int64(0)
-
-	for currentOffset < endOffset {
-		// Get key for this block
-		keyIndex := file.KeyIndex + blockIndex
-		key, err := crypto.ExtractKeyFromKeyMap(task.KeyMapData, keyIndex)
-		if err != nil {
-			return FileResult{
-				FileName: file.Name,
-				Success:  false,
-				Message:  fmt.Sprintf("failed to extract key: %v", err),
-			}
-		}
-
-		// Decrypt block
-		nextOffset, decryptedData, err := crypto.DecryptNTEncodeBlock(task.Region6Data, currentOffset, key)
-		if err != nil {
-			return FileResult{
-				FileName: file.Name,
-				Success:  false,
-				Message:  fmt.Sprintf("decryption failed at block %d: %v", blockIndex, err),
-			}
-		}
-
-		// Decompress block
-		decompressedData, err := decompressLZMA2(decryptedData)
-		if err != nil {
-			return FileResult{
-				FileName: file.Name,
-				Success:  false,
-				Message:  fmt.Sprintf("decompression failed at block %d: %v", blockIndex, err),
-			}
-		}
-
-		fileData.Write(decompressedData)
-
-		// Update progress bar with actual decompressed bytes
-		processedBytes += int64(len(decompressedData))
-		if fileBar != nil {
-			fileBar.Set64(processedBytes)
-		}
-
-		currentOffset = nextOffset
-		blockIndex++
-	}
-
-	// Finish progress bar
-	if fileBar != nil {
-		fileBar.Finish()
-	}
-
-	finalData := fileData.Bytes()
-
-	// Verify hash
-	if !verifyHash(finalData, file.FileSha256Hash) {
-		return FileResult{
-			FileName: file.Name,
-			Success:  false,
-			Message:  "hash verification failed",
-		}
-	}
-
-	// Write to file
-	if err := os.WriteFile(outputPath, finalData, 0644); err != nil {
-		return FileResult{
-			FileName: file.Name,
-			Success:  false,
-			Message:  fmt.Sprintf("failed to write file: %v", err),
-		}
-	}
-
-	return FileResult{
-		FileName: file.Name,
-		Success:  true,
-		Message:  "OK",
-	}
-}
-
-// estimateBlockCount estimates the number of blocks in a file
-func estimateBlockCount(fileLength uint64) int {
-	// Average block size is approximately 1MB after decompression
-	// This is a rough estimate for progress bar purposes
-	avgBlockSize := uint64(1024 * 1024) // 1MB
-	estimatedBlocks := int(fileLength / avgBlockSize)
-	if estimatedBlocks < 1 {
-		estimatedBlocks = 1
+// resolveWorkers auto-detects the optimal worker count if not specified.
+// Workers decode individual blocks, so one per CPU keeps every core busy.
+func resolveWorkers(numWorkers int) int {
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
 	}
-	return estimatedBlocks
+	return numWorkers
 }
 
 // truncateFileName truncates a filename to a maximum length
@@ -391,5 +244,3 @@ func formatSize(bytes uint64) string {
 		return fmt.Sprintf("%d B", bytes)
 	}
 }
-
-// Continue in next file...
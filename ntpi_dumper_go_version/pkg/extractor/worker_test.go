@@ -0,0 +1,114 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/internal/ntpitest"
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/parser"
+)
+
+func TestExtractFiles(t *testing.T) {
+	files := append(testFiles(), ntpitest.File{
+		Name: "corrupt.img",
+		Data: []byte("partition with a wrong hash"),
+		Hash: strings.Repeat("0", 64),
+	})
+	input := ntpitest.Write(t, files...)
+	tempDir := filepath.Join(t.TempDir(), "stage1")
+	outputDir := filepath.Join(t.TempDir(), "out")
+
+	recorder := &Recorder{}
+	if err := parser.ParseNTPIFile(input, tempDir, parser.Options{Reporter: recorder}); err != nil {
+		t.Fatalf("ParseNTPIFile: %v", err)
+	}
+	if n := recorder.Count("RegionSaved"); n != 6 {
+		t.Errorf("Stage 1 saved %d regions, want 6", n)
+	}
+
+	err := ExtractFiles(tempDir, outputDir, Options{Workers: 3, Reporter: recorder})
+
+	// Only corrupt.img fails, with a hash mismatch
+	var extractionErr *ExtractionError
+	if !errors.As(err, &extractionErr) {
+		t.Fatalf("ExtractFiles: got %v, want an ExtractionError", err)
+	}
+	var mismatch *HashMismatchError
+	if len(extractionErr.Failed) != 1 || extractionErr.Failed[0].File != "corrupt.img" ||
+		!errors.As(extractionErr.Failed[0].Err, &mismatch) {
+		t.Fatalf("ExtractFiles: got %v, want a hash mismatch on corrupt.img only", err)
+	}
+
+	blocks := 0
+	for _, file := range files {
+		blocks += max(1, (len(file.Data)+ntpitest.BlockSize-1)/ntpitest.BlockSize)
+	}
+	counts := map[string]int{
+		"ExtractionStarted": 1,
+		"FileQueued":        len(files),
+		"BlockDecoded":      blocks,
+		"FileDone":          len(files),
+		"ExtractionDone":    1,
+	}
+	for kind, want := range counts {
+		if n := recorder.Count(kind); n != want {
+			t.Errorf("%d %s events, want %d", n, kind, want)
+		}
+	}
+
+	summary := recorder.Summary()
+	if summary == nil || summary.Succeeded != len(files)-1 || len(summary.Results) != len(files) {
+		t.Fatalf("summary %+v, want %d of %d succeeded", summary, len(files)-1, len(files))
+	}
+	for _, result := range recorder.Results() {
+		if result.Success != (result.FileName != "corrupt.img") {
+			t.Errorf("%s: success = %v (%s)", result.FileName, result.Success, result.Message)
+		}
+	}
+
+	for _, file := range files[:len(files)-1] {
+		data, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(file.Name)))
+		if err != nil {
+			t.Errorf("%s: %v", file.Name, err)
+			continue
+		}
+		if !bytes.Equal(data, file.Data) {
+			t.Errorf("%s: extracted %d bytes that differ from the partition", file.Name, len(data))
+		}
+	}
+}
+
+func TestSelectFiles(t *testing.T) {
+	files := []parser.FileInfo{{Name: "boot.img"}, {Name: "sub/vendor.img"}, {Name: "userdata.img"}}
+	tests := []struct {
+		only, exclude []string
+		want          string
+	}{
+		{nil, nil, "boot.img sub/vendor.img userdata.img"},
+		{[]string{"boot*"}, nil, "boot.img"},
+		{[]string{"vendor.img"}, nil, "sub/vendor.img"}, // Base name
+		{[]string{"sub/*"}, nil, "sub/vendor.img"},
+		{nil, []string{"userdata.img"}, "boot.img sub/vendor.img"},
+		{[]string{"*.img"}, []string{"boot.img"}, "sub/vendor.img userdata.img"},
+		{[]string{"missing*"}, nil, "error"},
+		{[]string{"["}, nil, "error"},
+	}
+	for _, tt := range tests {
+		selected, err := Options{Only: tt.only, Exclude: tt.exclude}.selectFiles(files)
+		got := "error"
+		if err == nil {
+			var names []string
+			for _, file := range selected {
+				names = append(names, file.Name)
+			}
+			got = strings.Join(names, " ")
+		}
+		if got != tt.want {
+			t.Errorf("only %q exclude %q: got %s, want %s", tt.only, tt.exclude, got, tt.want)
+		}
+	}
+}
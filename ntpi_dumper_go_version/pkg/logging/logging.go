@@ -0,0 +1,149 @@
+// Package logging provides the leveled logger shared by the parser and extractor
+package logging
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// Level is the minimum severity a logger writes
+type Level int
+
+const (
+	LevelDebug   Level = iota // Dumps of decrypted headers (--debug)
+	LevelVerbose              // Per-block details (-v)
+	LevelInfo                 // Normal progress output
+	LevelWarn                 // Problems that do not stop extraction
+	LevelError                // Failures
+)
+
+// String returns the lower-case name of the level
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelVerbose:
+		return "verbose"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// Logger is a leveled, printf-style logger. Implementations must be safe for
+// concurrent use.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Verbosef(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// Discard is a Logger that drops everything
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Debugf(string, ...any)   {}
+func (discard) Verbosef(string, ...any) {}
+func (discard) Infof(string, ...any)    {}
+func (discard) Warnf(string, ...any)    {}
+func (discard) Errorf(string, ...any)   {}
+
+// TextLogger writes human-readable lines. Info and verbose lines are written
+// as-is; other levels get a (colored) prefix.
+type TextLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	copy  io.Writer // Receives every line of every level without color, e.g. --log-file
+}
+
+// NewLogger creates a TextLogger writing messages of at least level to w
+func NewLogger(w io.Writer, level Level) *TextLogger {
+	return &TextLogger{w: w, level: level}
+}
+
+// CopyTo also writes every logged line to w, with ANSI color sequences
+// removed. Lines below the logger's level go to w too, so a log file keeps
+// the details the console leaves out.
+func (l *TextLogger) CopyTo(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.copy = w
+}
+
+// Enabled reports whether messages of level are written, to w or the copy
+func (l *TextLogger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level || l.copy != nil
+}
+
+// Debugf logs a debug message
+func (l *TextLogger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, color.New(color.FgHiBlack).Sprint("Debug:"), format, args...)
+}
+
+// Verbosef logs a detail message
+func (l *TextLogger) Verbosef(format string, args ...any) {
+	l.logf(LevelVerbose, "", format, args...)
+}
+
+// Infof logs an informational message
+func (l *TextLogger) Infof(format string, args ...any) {
+	l.logf(LevelInfo, "", format, args...)
+}
+
+// Warnf logs a warning
+func (l *TextLogger) Warnf(format string, args ...any) {
+	l.logf(LevelWarn, color.New(color.FgYellow).Sprint("Warning:"), format, args...)
+}
+
+// Errorf logs an error
+func (l *TextLogger) Errorf(format string, args ...any) {
+	l.logf(LevelError, color.New(color.FgRed).Sprint("Error:"), format, args...)
+}
+
+// logf writes one message to w if level is enabled, and to the copy always
+func (l *TextLogger) logf(level Level, prefix, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	if prefix != "" {
+		msg = prefix + " " + msg
+	}
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level >= l.level {
+		io.WriteString(l.w, msg)
+	}
+	if l.copy != nil {
+		io.WriteString(l.copy, StripANSI(msg))
+	}
+}
+
+// ansiSequence matches the SGR escape sequences used for colors
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// StripANSI removes color escape sequences from s
+func StripANSI(s string) string {
+	return ansiSequence.ReplaceAllString(s, "")
+}
@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCopyGetsEveryLevel(t *testing.T) {
+	var console, file bytes.Buffer
+	l := NewLogger(&console, LevelInfo)
+	l.CopyTo(&file)
+
+	l.Debugf("dump")
+	l.Verbosef("detail")
+	l.Infof("info")
+
+	if got := console.String(); got != "info\n" {
+		t.Errorf("console got %q, want only the info line", got)
+	}
+	if got, want := file.String(), "Debug: dump\ndetail\ninfo\n"; got != want {
+		t.Errorf("copy got %q, want %q", got, want)
+	}
+}
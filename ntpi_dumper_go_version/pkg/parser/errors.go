@@ -0,0 +1,31 @@
+// Package parser - Error types for NTPI parsing
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedVersion is returned when an archive with an unknown version
+// cannot be decrypted with the default keys
+var ErrUnsupportedVersion = errors.New("unsupported firmware version")
+
+// UnsupportedVersionError wraps a Stage 1 failure for a firmware version that
+// has no known keys
+type UnsupportedVersionError struct {
+	Version string
+	Err     error
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported firmware version %s: %v", e.Version, e.Err)
+}
+
+func (e *UnsupportedVersionError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrUnsupportedVersion) match any UnsupportedVersionError
+func (e *UnsupportedVersionError) Is(target error) bool {
+	return target == ErrUnsupportedVersion
+}
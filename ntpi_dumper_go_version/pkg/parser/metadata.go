@@ -0,0 +1,94 @@
+// Package parser - Archive metadata without a full Stage 1
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// metadataRegionType is the region holding Metadata.xml
+const metadataRegionType = 1
+
+// Metadata describes an NTPI archive: its header version and the fields of
+// its Metadata.xml
+type Metadata struct {
+	Version string            // NTPI header version
+	Fields  map[string]string // Metadata.xml leaf elements and attributes, keyed by lower-case name
+}
+
+// ReadMetadata reads the NTPI header and decrypts only the regions up to
+// Metadata.xml, without reading the rest of the archive
+func ReadMetadata(filePath string) (*Metadata, error) {
+	var content []byte
+	info, err := walkRegions(filePath, nil, func(region Region) bool {
+		if region.Type == metadataRegionType {
+			content = region.Data
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, errors.New("archive has no Metadata region")
+	}
+
+	fields, err := parseMetadataXML(content)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{Version: info.Version, Fields: fields}, nil
+}
+
+// parseMetadataXML collects the text of every leaf element and every
+// attribute. The first occurrence of a name wins.
+func parseMetadataXML(data []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	set := func(name, value string) {
+		name = strings.ToLower(name)
+		if _, ok := fields[name]; !ok {
+			fields[name] = strings.TrimSpace(value)
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		depth int
+		text  strings.Builder
+		leaf  bool // No child element since the current element started
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Metadata.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				set(attr.Name.Local, attr.Value)
+			}
+			depth++
+			text.Reset()
+			leaf = true
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if leaf && depth > 1 {
+				set(t.Name.Local, text.String())
+			}
+			depth--
+			leaf = false
+		}
+	}
+
+	return fields, nil
+}
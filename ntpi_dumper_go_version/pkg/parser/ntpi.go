@@ -2,14 +2,17 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/crypto"
 	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
-	"github.com/fatih/color"
 )
 
 // FileInfo represents metadata for a single file from FileIndex.xml
@@ -34,151 +37,120 @@ type FileIndex struct {
 }
 
 // ParseNTPIFile reads and parses an NTPI file, extracting all regions (Stage 1)
-func ParseNTPIFile(filePath string, outputDir string) error {
-	cyan := color.New(color.FgCyan).SprintFunc()
-	green := color.New(color.FgGreen).SprintFunc()
-	yellow := color.New(color.FgYellow).SprintFunc()
+func ParseNTPIFile(filePath string, outputDir string, opts Options) error {
+	reporter := opts.reporter()
 
-	fmt.Printf("%s\n", cyan("=== Stage 1: Parsing NTPI File ==="))
-
-	// Read entire NTPI file into memory
-	fileData, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read NTPI file: %w", err)
+	// Create output directory
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	fileSize := float64(len(fileData)) / (1024 * 1024)
-	fmt.Printf("File size: %s\n", cyan(fmt.Sprintf("%.2f MB", fileSize)))
+	opened := func(info *ArchiveInfo, header *structures.NTPIHeader, headerData []byte) {
+		reporter.Debugf("NTPI header: version %s, first region (type %d, size %d)\n%s",
+			header.Version(), header.FirstRegion.RegionType, header.FirstRegion.RegionSize,
+			hex.Dump(headerData))
+		reporter.ArchiveOpened(*info)
+		if !info.Supported {
+			reporter.Warnf("Unsupported firmware version, using default keys")
+		}
+	}
 
-	// Parse NTPI header
-	header, err := structures.ParseNTPIHeader(fileData)
+	regionCount := 0
+	var saveErr error
+	_, err := walkRegions(filePath, opened, func(region Region) bool {
+		regionCount++
+		reporter.RegionFound(region.RegionInfo)
+		if err := saveRegion(filePath, region, outputDir, reporter); err != nil {
+			saveErr = fmt.Errorf("failed to extract region %s: %w", region.Name, err)
+			return false
+		}
+		return true
+	})
 	if err != nil {
-		return fmt.Errorf("failed to parse NTPI header: %w", err)
+		return err
 	}
-
-	fmt.Printf("NTPI Version: %s\n", green(header.Version()))
-
-	// Get AES key dictionary for this version
-	keyDict := structures.GetAESDictForVersion(header.VersionMajor, header.VersionMinor, header.VersionPatch)
-	if keyDict == nil {
-		fmt.Printf("%s\n", yellow("Warning: Unsupported firmware version, using default keys"))
-		keyDict = structures.DefaultAESDict
+	if saveErr != nil {
+		return saveErr
 	}
 
-	// Create output directory
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
+	reporter.ArchiveParsed(regionCount)
+	return nil
+}
 
-	// Start extracting regions
-	currentOffset := header.Size()
-	currentRegion := header.FirstRegion
-	regionCount := 0
+// saveRegion writes the decrypted content of a region to outputDir. Region6
+// is copied from the archive as-is for later processing.
+func saveRegion(filePath string, region Region, outputDir string, reporter Reporter) error {
+	outputFile := filepath.Join(outputDir, RegionFileName(region.Type))
 
-	for {
-		regionCount++
-		regionName := structures.RegionName(currentRegion.RegionType)
-
-		fmt.Printf("\n%s %s (Type=%d, Size=%d bytes)\n",
-			cyan("Processing Region:"),
-			green(regionName),
-			currentRegion.RegionType,
-			currentRegion.RegionSize,
-		)
-
-		// Extract region data
-		nextOffset, nextRegion, err := extractRegion(fileData, currentRegion, currentOffset, outputDir, keyDict)
-		if err != nil {
-			return fmt.Errorf("failed to extract region %s: %w", regionName, err)
+	if region.Type == region6Type {
+		if err := copyRegion(filePath, region, outputFile); err != nil {
+			return fmt.Errorf("failed to save Region6: %w", err)
 		}
+		reporter.RegionSaved(region.RegionInfo, outputFile, int(region.Size))
+		return nil
+	}
 
-		// Check if there are more regions
-		if nextOffset == -1 || nextRegion == nil {
-			break
-		}
+	var headerData bytes.Buffer
+	binary.Write(&headerData, binary.LittleEndian, region.Header)
+	reporter.Debugf("%s block header: this=(type %d, size %d) next=(type %d, size %d) real_size=%d\n%s",
+		region.Name, region.Header.ThisHeader.RegionType, region.Header.ThisHeader.RegionSize,
+		region.Header.NextHeader.RegionType, region.Header.NextHeader.RegionSize, region.Header.RealSize,
+		hex.Dump(headerData.Bytes()))
 
-		currentOffset = nextOffset
-		currentRegion = *nextRegion
+	if err := os.WriteFile(outputFile, region.Data, 0644); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
 	}
-
-	fmt.Printf("\n%s\n", green(fmt.Sprintf("Successfully extracted %d regions", regionCount)))
+	reporter.RegionSaved(region.RegionInfo, outputFile, len(region.Data))
 	return nil
 }
 
-// extractRegion extracts and decrypts a single region
-func extractRegion(fileData []byte, regionHeader structures.RegionHeader, offset int, outputDir string, keyDict *structures.AESKeyDict) (int, *structures.RegionHeader, error) {
-	regionName := structures.RegionName(regionHeader.RegionType)
-
-	// Validate region boundaries
-	regionEnd := offset + int(regionHeader.RegionSize)
-	if regionEnd > len(fileData) {
-		return 0, nil, fmt.Errorf("region data out of bounds: offset=%d, size=%d, file_size=%d",
-			offset, regionHeader.RegionSize, len(fileData))
+// copyRegion copies the stored bytes of a region from the archive to path
+func copyRegion(filePath string, region Region, path string) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	// Extract region data
-	regionData := fileData[offset:regionEnd]
-
-	// Region6 contains encrypted file blocks, save as-is for later processing
-	if regionHeader.RegionType == 6 {
-		outputFile := filepath.Join(outputDir, "region6block.bin")
-		if err := os.WriteFile(outputFile, regionData, 0644); err != nil {
-			return 0, nil, fmt.Errorf("failed to save Region6: %w", err)
-		}
-		fmt.Printf("  Saved to: %s\n", outputFile)
-		return -1, nil, nil
+	out, err := os.Create(path)
+	if err != nil {
+		return err
 	}
+	if _, err := io.Copy(out, io.NewSectionReader(in, region.Offset, int64(region.Size))); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
 
+// decryptRegion decrypts a region and parses its block header. The region's
+// content is the RealSize bytes following the header, which are checked to
+// be within the decrypted data.
+func decryptRegion(regionData []byte, regionType uint64, keyDict *structures.AESKeyDict) (*structures.RegionBlockHeader, []byte, error) {
 	// Decrypt the region data
-	decryptedData, err := crypto.DecryptRegionData(regionData, regionHeader.RegionType, keyDict)
+	decryptedData, err := crypto.DecryptRegionData(regionData, regionType, keyDict)
 	if err != nil {
-		return 0, nil, fmt.Errorf("decryption failed: %w", err)
+		return nil, nil, fmt.Errorf("decryption failed: %w", err)
 	}
 
 	// Parse region block header from decrypted data
 	if len(decryptedData) < 40 {
-		return 0, nil, fmt.Errorf("decrypted data too small for RegionBlockHeader: %d bytes", len(decryptedData))
+		return nil, nil, fmt.Errorf("decrypted data too small for RegionBlockHeader: %d bytes", len(decryptedData))
 	}
 
 	blockHeader, err := structures.ParseRegionBlockHeader(decryptedData)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to parse region block header: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse region block header: %w", err)
 	}
 
-	// Extract actual data content
-	dataOffset := 40 // Size of RegionBlockHeader
-	dataEnd := dataOffset + int(blockHeader.RealSize)
-
-	if dataEnd > len(decryptedData) {
-		return 0, nil, fmt.Errorf("real data size exceeds decrypted buffer: real_size=%d, buffer_size=%d",
-			blockHeader.RealSize, len(decryptedData))
-	}
-
-	actualData := decryptedData[dataOffset:dataEnd]
-
-	// Save to file
-	var outputFile string
-	if regionHeader.RegionType == 4 {
-		// KeyMap is binary
-		outputFile = filepath.Join(outputDir, fmt.Sprintf("%s.bin", regionName))
-	} else {
-		// Others are XML
-		outputFile = filepath.Join(outputDir, fmt.Sprintf("%s.xml", regionName))
-	}
-
-	if err := os.WriteFile(outputFile, actualData, 0644); err != nil {
-		return 0, nil, fmt.Errorf("failed to save file: %w", err)
+	// Compared as uint64: a garbage RealSize would overflow an int
+	if blockHeader.RealSize > uint64(len(decryptedData)-blockHeader.Size()) {
+		// A wrong key produces garbage headers, so report this as a decryption failure
+		return nil, nil, fmt.Errorf("%w: real data size exceeds decrypted buffer: real_size=%d, buffer_size=%d",
+			crypto.ErrDecrypt, blockHeader.RealSize, len(decryptedData))
 	}
 
-	fmt.Printf("  Saved to: %s (%.2f KB)\n", outputFile, float64(len(actualData))/1024)
-
-	// Check if there's a next region
-	if blockHeader.NextHeader.RegionSize > 0 {
-		nextOffset := offset + int(regionHeader.RegionSize)
-		return nextOffset, &blockHeader.NextHeader, nil
-	}
-
-	return -1, nil, nil
+	return blockHeader, decryptedData, nil
 }
 
 // ParseFileIndex parses FileIndex.xml and returns a list of files
@@ -187,7 +159,11 @@ func ParseFileIndex(fileIndexPath string) ([]FileInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read FileIndex.xml: %w", err)
 	}
+	return ParseFileIndexData(data)
+}
 
+// ParseFileIndexData parses the content of FileIndex.xml
+func ParseFileIndexData(data []byte) ([]FileInfo, error) {
 	var fileIndex FileIndex
 	if err := xml.Unmarshal(data, &fileIndex); err != nil {
 		return nil, fmt.Errorf("failed to parse FileIndex.xml: %w", err)
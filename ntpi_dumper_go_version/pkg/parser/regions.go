@@ -0,0 +1,130 @@
+// Package parser - Reading the region chain without a full Stage 1
+package parser
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+// region6Type is the region holding the encrypted file blocks
+const region6Type = 6
+
+// Region is one region of an NTPI archive. Region6 is only described: its
+// data is the bulk of the archive and is left to Stage 2.
+type Region struct {
+	RegionInfo
+	Offset    int64                         // Offset of the region data in the archive
+	Encrypted []byte                        // Region data as stored (nil for Region6)
+	Header    *structures.RegionBlockHeader // Decrypted block header (nil for Region6)
+	Data      []byte                        // Decrypted content (nil for Region6)
+}
+
+// RegionFileName returns the name Stage 1 saves a region's content under
+func RegionFileName(regionType uint64) string {
+	switch regionType {
+	case 4:
+		// KeyMap is binary
+		return structures.RegionName(regionType) + ".bin"
+	case region6Type:
+		return "region6block.bin"
+	default:
+		// Others are XML
+		return structures.RegionName(regionType) + ".xml"
+	}
+}
+
+// ReadRegions decrypts every region in the chain of an NTPI file, reading
+// only the regions themselves
+func ReadRegions(filePath string) (*ArchiveInfo, []Region, error) {
+	var regions []Region
+	info, err := walkRegions(filePath, nil, func(region Region) bool {
+		regions = append(regions, region)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, regions, nil
+}
+
+// walkRegions decrypts the regions of an NTPI file in chain order and passes
+// each to visit until it returns false. Region6 ends the chain. opened, if
+// not nil, is called with the parsed NTPI header before any region is read.
+func walkRegions(filePath string, opened func(info *ArchiveInfo, header *structures.NTPIHeader, headerData []byte), visit func(region Region) bool) (*ArchiveInfo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NTPI file: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NTPI file: %w", err)
+	}
+
+	headerData := make([]byte, (&structures.NTPIHeader{}).Size())
+	if _, err := io.ReadFull(f, headerData); err != nil {
+		return nil, fmt.Errorf("failed to parse NTPI header: %w: %v", structures.ErrShortData, err)
+	}
+	header, err := structures.ParseNTPIHeader(headerData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NTPI header: %w", err)
+	}
+
+	keyDict, supported := structures.FindAESDictForVersion(header.VersionMajor, header.VersionMinor, header.VersionPatch)
+	if !supported {
+		keyDict = structures.DefaultAESDict
+	}
+	info := &ArchiveInfo{Path: filePath, Size: stat.Size(), Version: header.Version(), Supported: supported}
+	if opened != nil {
+		opened(info, header, headerData)
+	}
+
+	// Regions are chained: each decrypted region names the next one
+	offset := int64(header.Size())
+	current := header.FirstRegion
+	for {
+		region := Region{
+			RegionInfo: RegionInfo{
+				Type: current.RegionType,
+				Name: structures.RegionName(current.RegionType),
+				Size: current.RegionSize,
+			},
+			Offset: offset,
+		}
+		if current.RegionSize > uint64(stat.Size()-offset) {
+			return nil, fmt.Errorf("failed to extract region %s: %w: region data out of bounds: offset=%d, size=%d, file_size=%d",
+				region.Name, structures.ErrShortData, offset, current.RegionSize, stat.Size())
+		}
+		if current.RegionType == region6Type {
+			visit(region)
+			return info, nil
+		}
+
+		region.Encrypted = make([]byte, current.RegionSize)
+		if _, err := f.ReadAt(region.Encrypted, offset); err != nil {
+			return nil, fmt.Errorf("failed to read NTPI file: %w", err)
+		}
+
+		blockHeader, decryptedData, err := decryptRegion(region.Encrypted, current.RegionType, keyDict)
+		if err != nil {
+			err = fmt.Errorf("failed to extract region %s: %w", region.Name, err)
+			if !supported {
+				// Most likely the default keys are simply wrong for this version
+				return nil, &UnsupportedVersionError{Version: header.Version(), Err: err}
+			}
+			return nil, err
+		}
+		region.Header = blockHeader
+		region.Data = decryptedData[blockHeader.Size() : blockHeader.Size()+int(blockHeader.RealSize)]
+
+		if !visit(region) || blockHeader.NextHeader.RegionSize == 0 {
+			return info, nil
+		}
+		offset += int64(current.RegionSize)
+		current = blockHeader.NextHeader
+	}
+}
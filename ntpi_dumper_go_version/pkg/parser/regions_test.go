@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YunWaiHe/ntpi-dumper-go/pkg/structures"
+)
+
+// writeGarbageArchive writes an archive of unknown version whose first region
+// decrypts, with the default keys, to a block header claiming realSize bytes.
+// This is what a region encrypted with another key looks like.
+func writeGarbageArchive(t *testing.T, realSize uint64) string {
+	t.Helper()
+
+	var plain bytes.Buffer
+	binary.Write(&plain, binary.LittleEndian, structures.RegionBlockHeader{
+		ThisHeader: structures.RegionHeader{RegionType: 1},
+		NextHeader: structures.RegionHeader{RegionType: 2, RegionSize: 64},
+		RealSize:   realSize,
+	})
+	plain.Write(make([]byte, 64-plain.Len()))
+
+	key, _ := hex.DecodeString(structures.DefaultAESDict.GetKeyForRegion(1))
+	iv, _ := hex.DecodeString(structures.DefaultAESDict.GetIVForRegion(1))
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	region := make([]byte, plain.Len())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(region, plain.Bytes())
+
+	var archive bytes.Buffer
+	binary.Write(&archive, binary.LittleEndian, structures.NTPIHeader{
+		Magic:        [4]byte{'N', 'T', 'P', 'I'},
+		VersionMajor: 9,
+		VersionMinor: 9,
+		FirstRegion:  structures.RegionHeader{RegionType: 1, RegionSize: uint64(len(region))},
+	})
+	archive.Write(region)
+
+	path := filepath.Join(t.TempDir(), "garbage.ntpi")
+	if err := os.WriteFile(path, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWrongKeyIsUnsupportedVersion(t *testing.T) {
+	sizes := []uint64{
+		1 << 20,     // Larger than the region
+		1<<64 - 8,   // Overflows an int once the header size is added
+		1<<63 + 100, // Negative as an int
+	}
+	for _, realSize := range sizes {
+		path := writeGarbageArchive(t, realSize)
+
+		_, _, err := ReadRegions(path)
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("ReadRegions with real_size=%d: got %v, want ErrUnsupportedVersion", realSize, err)
+		}
+		err = ParseNTPIFile(path, t.TempDir(), Options{})
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("ParseNTPIFile with real_size=%d: got %v, want ErrUnsupportedVersion", realSize, err)
+		}
+	}
+}
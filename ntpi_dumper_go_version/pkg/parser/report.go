@@ -0,0 +1,57 @@
+// Package parser - Stage 1 reporting hooks
+package parser
+
+import "github.com/YunWaiHe/ntpi-dumper-go/pkg/logging"
+
+// ArchiveInfo describes an NTPI file once its header has been parsed
+type ArchiveInfo struct {
+	Path      string
+	Size      int64
+	Version   string
+	Supported bool // False when the default keys are used for an unknown version
+}
+
+// RegionInfo describes a region found while parsing an NTPI file
+type RegionInfo struct {
+	Type uint64
+	Name string
+	Size uint64 // Encrypted size in the NTPI file
+}
+
+// Reporter receives Stage 1 events. Parsing runs on the caller's goroutine,
+// so implementations need not be safe for concurrent use by the parser alone.
+type Reporter interface {
+	logging.Logger
+
+	// ArchiveOpened is called once the NTPI header has been parsed
+	ArchiveOpened(info ArchiveInfo)
+	// RegionFound is called for every region before it is extracted
+	RegionFound(region RegionInfo)
+	// RegionSaved is called once a region's data of size bytes is written to path
+	RegionSaved(region RegionInfo, path string, size int)
+	// ArchiveParsed is called after all regions have been extracted
+	ArchiveParsed(regions int)
+}
+
+// Options configures Stage 1
+type Options struct {
+	Reporter Reporter // Receives progress and log output; nil for none
+}
+
+// silentReporter discards all Stage 1 events
+type silentReporter struct {
+	logging.Logger
+}
+
+func (silentReporter) ArchiveOpened(ArchiveInfo)           {}
+func (silentReporter) RegionFound(RegionInfo)              {}
+func (silentReporter) RegionSaved(RegionInfo, string, int) {}
+func (silentReporter) ArchiveParsed(int)                   {}
+
+// reporter returns the configured reporter or a silent one
+func (o Options) reporter() Reporter {
+	if o.Reporter == nil {
+		return silentReporter{logging.Discard}
+	}
+	return o.Reporter
+}
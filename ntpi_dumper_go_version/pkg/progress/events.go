@@ -0,0 +1,174 @@
+// Package progress - Newline-delimited JSON event stream for front-ends
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// ModeJSON emits NDJSON events instead of drawing anything
+const ModeJSON Mode = "json"
+
+// jsonInterval is how often a "progress" event is emitted
+const jsonInterval = 500 * time.Millisecond
+
+// EventWriter writes one JSON object per line. Every event starts with its
+// "type" and an RFC 3339 "time", followed by the fields of its payload.
+// A nil *EventWriter discards everything, so callers need not check.
+type EventWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewEventWriter creates an event stream on w
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{w: w}
+}
+
+// StageEvent is emitted as "stage_start" and "stage_end"
+type StageEvent struct {
+	Stage      string `json:"stage"`
+	OK         *bool  `json:"ok,omitempty"` // stage_end only
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// RegionEvent is emitted as "region" for every region found in Stage 1
+type RegionEvent struct {
+	Region string `json:"region"`
+	Type   uint64 `json:"region_type"`
+	Size   uint64 `json:"size"`
+}
+
+// FileEvent is emitted as "file_queued", "file_started" and "file_done"
+type FileEvent struct {
+	File       string `json:"file"`
+	Size       int64  `json:"size"`
+	Bytes      int64  `json:"bytes"`
+	OK         *bool  `json:"ok,omitempty"` // file_done only
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// FileProgress is the state of one active file in a "progress" event
+type FileProgress struct {
+	File  string `json:"file"`
+	Bytes int64  `json:"bytes"`
+	Size  int64  `json:"size"`
+}
+
+// ProgressEvent is emitted as "progress" periodically while files are extracted
+type ProgressEvent struct {
+	Bytes       int64          `json:"bytes"`
+	TotalBytes  int64          `json:"total_bytes"`
+	FilesDone   int            `json:"files_done"`
+	FilesTotal  int            `json:"files_total"`
+	BytesPerSec float64        `json:"bytes_per_sec"`
+	ETASeconds  float64        `json:"eta_seconds"`
+	Active      []FileProgress `json:"active"`
+}
+
+// Emit writes an event of the given type. payload must marshal to a JSON
+// object (or be nil).
+func (e *EventWriter) Emit(eventType string, payload any) {
+	if e == nil {
+		return
+	}
+
+	head, _ := json.Marshal(struct {
+		Type string    `json:"type"`
+		Time time.Time `json:"time"`
+	}{eventType, time.Now()})
+
+	line := head
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err == nil && len(body) > 2 && body[0] == '{' {
+			// Splice the payload's fields after type and time
+			line = append(bytes.TrimSuffix(head, []byte("}")), ',')
+			line = append(line, body[1:]...)
+		}
+	}
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(line)
+}
+
+// StageStart emits "stage_start" and returns the start time for StageEnd
+func (e *EventWriter) StageStart(stage string) time.Time {
+	e.Emit("stage_start", StageEvent{Stage: stage})
+	return time.Now()
+}
+
+// StageEnd emits "stage_end" with the stage's outcome
+func (e *EventWriter) StageEnd(stage string, start time.Time, err error) {
+	ok := err == nil
+	event := StageEvent{Stage: stage, OK: &ok, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	e.Emit("stage_end", event)
+}
+
+// NewJSON starts a renderer that reports files of totalBytes to events
+func NewJSON(events *EventWriter, totalBytes int64, totalFiles int) *Renderer {
+	r := &Renderer{
+		mode:       ModeJSON,
+		events:     events,
+		start:      time.Now(),
+		totalBytes: totalBytes,
+		totalFiles: totalFiles,
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go r.loop(jsonInterval)
+	return r
+}
+
+// emitProgress writes a "progress" event with the state of every active file
+func (r *Renderer) emitProgress() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	done := r.done.Load()
+	elapsed := time.Since(r.start).Seconds()
+	event := ProgressEvent{
+		Bytes:      done,
+		TotalBytes: r.totalBytes,
+		FilesDone:  r.nDone,
+		FilesTotal: r.totalFiles,
+		Active:     make([]FileProgress, 0, len(r.tasks)),
+	}
+	if elapsed > 0 {
+		event.BytesPerSec = float64(done) / elapsed
+	}
+	if done > 0 {
+		event.ETASeconds = float64(r.totalBytes-done) / float64(done) * elapsed
+	}
+	for _, t := range r.tasks {
+		event.Active = append(event.Active, FileProgress{File: t.name, Bytes: t.current.Load(), Size: t.size})
+	}
+
+	r.events.Emit("progress", event)
+}
+
+// fileEvent builds the payload of a file event
+func (t *Task) fileEvent(err error, final bool) FileEvent {
+	event := FileEvent{File: t.name, Size: t.size, Bytes: t.current.Load()}
+	if final {
+		ok := err == nil
+		event.OK = &ok
+		if err != nil {
+			event.Error = err.Error()
+		}
+		if !t.started.IsZero() {
+			event.DurationMS = time.Since(t.started).Milliseconds()
+		}
+	}
+	return event
+}
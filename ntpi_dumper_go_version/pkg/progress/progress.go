@@ -0,0 +1,286 @@
+// Package progress - Single terminal progress renderer for concurrent file extraction
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"golang.org/x/term"
+)
+
+// Mode selects how progress is displayed
+type Mode string
+
+const (
+	// ModeAuto uses bars on a terminal and plain lines otherwise (or in CI)
+	ModeAuto Mode = "auto"
+	// ModeBar redraws one line per active file plus an overall bar
+	ModeBar Mode = "bar"
+	// ModePlain prints periodic percentage lines, suitable for logs
+	ModePlain Mode = "plain"
+	// ModeNone shows no progress at all
+	ModeNone Mode = "none"
+)
+
+const (
+	// barInterval is how often bars are redrawn
+	barInterval = 100 * time.Millisecond
+	// plainInterval is how often a plain progress line is printed
+	plainInterval = 5 * time.Second
+	// maxActiveLines limits how many file lines are shown at once
+	maxActiveLines = 8
+)
+
+// ParseMode validates a --progress value
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeAuto, nil
+	case ModeAuto, ModeBar, ModePlain, ModeNone, ModeJSON:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown progress mode %q (want auto, bar, plain, json or none)", s)
+	}
+}
+
+// resolve turns ModeAuto into bars or plain lines depending on the output
+func (m Mode) resolve(out *os.File) Mode {
+	if m != ModeAuto {
+		return m
+	}
+	if os.Getenv("CI") != "" || os.Getenv("TERM") == "dumb" || !term.IsTerminal(int(out.Fd())) {
+		return ModePlain
+	}
+	return ModeBar
+}
+
+// Renderer owns the progress output. Files report into Tasks from any
+// goroutine; only the renderer writes to the terminal.
+type Renderer struct {
+	out    *os.File
+	w      io.Writer
+	events *EventWriter // ModeJSON only
+	mode   Mode
+	start  time.Time
+
+	totalBytes int64
+	totalFiles int
+	done       atomic.Int64 // Bytes completed across all files
+
+	mu       sync.Mutex
+	tasks    []*Task  // In order of first progress
+	finished []string // Completion lines not yet printed
+	nDone    int      // Files finished
+	lines    int      // Lines of the live block currently on screen
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Task tracks the progress of one file
+type Task struct {
+	r       *Renderer
+	name    string
+	size    int64
+	current atomic.Int64
+	shown   atomic.Bool // Set once the file has been added to the live block (or finished)
+	started time.Time   // Set on first progress, guarded by Renderer.mu
+}
+
+// New starts a renderer drawing to out for totalFiles files of totalBytes.
+// Use NewJSON for ModeJSON; here it is treated as ModeNone.
+func New(out *os.File, mode Mode, totalBytes int64, totalFiles int) *Renderer {
+	r := &Renderer{
+		out:        out,
+		w:          colorable.NewColorable(out),
+		mode:       mode.resolve(out),
+		start:      time.Now(),
+		totalBytes: totalBytes,
+		totalFiles: totalFiles,
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+
+	if r.mode == ModeJSON {
+		r.mode = ModeNone
+	}
+
+	switch r.mode {
+	case ModeBar:
+		go r.loop(barInterval)
+	case ModePlain:
+		go r.loop(plainInterval)
+	default:
+		close(r.stopped)
+	}
+
+	return r
+}
+
+// AddFile registers a file. It is shown once it first reports progress.
+func (r *Renderer) AddFile(name string, size int64) *Task {
+	t := &Task{r: r, name: name, size: size}
+	r.events.Emit("file_queued", t.fileEvent(nil, false))
+	return t
+}
+
+// Set records that n bytes of the file have been written
+func (t *Task) Set(n int64) {
+	if t == nil {
+		return
+	}
+	delta := n - t.current.Swap(n)
+	t.r.done.Add(delta)
+
+	if n > 0 && !t.shown.Load() {
+		t.r.mu.Lock()
+		if !t.shown.Load() {
+			t.shown.Store(true)
+			t.started = time.Now()
+			t.r.tasks = append(t.r.tasks, t)
+			t.r.events.Emit("file_started", t.fileEvent(nil, false))
+		}
+		t.r.mu.Unlock()
+	}
+}
+
+// Finish marks the file as done, successfully when err is nil
+func (t *Task) Finish(err error) {
+	if t == nil {
+		return
+	}
+	r := t.r
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.shown.Store(true)
+	for i, task := range r.tasks {
+		if task == t {
+			r.tasks = append(r.tasks[:i], r.tasks[i+1:]...)
+			break
+		}
+	}
+	r.nDone++
+	r.events.Emit("file_done", t.fileEvent(err, true))
+
+	if r.mode == ModeBar || r.mode == ModePlain {
+		r.finished = append(r.finished, r.finishedLine(t, err))
+	}
+}
+
+// Stop prints the final state and releases the terminal
+func (r *Renderer) Stop() {
+	select {
+	case <-r.stop:
+		return // Already stopped
+	default:
+	}
+	close(r.stop)
+	<-r.stopped
+}
+
+// loop redraws every interval until stopped
+func (r *Renderer) loop(interval time.Duration) {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Completion lines are flushed promptly even in plain mode
+	flush := time.NewTicker(barInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			r.draw(true)
+			return
+		case <-ticker.C:
+			r.draw(false)
+		case <-flush.C:
+			if r.mode == ModePlain {
+				r.flushFinished()
+			}
+		}
+	}
+}
+
+// flushFinished prints pending completion lines (plain mode)
+func (r *Renderer) flushFinished() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, line := range r.finished {
+		fmt.Fprintln(r.w, line)
+	}
+	r.finished = nil
+}
+
+// draw writes the current state. In bar mode the live block is redrawn in
+// place; in plain mode a single summary line is appended, and in JSON mode
+// a "progress" event is emitted.
+func (r *Renderer) draw(final bool) {
+	if r.mode == ModeJSON {
+		r.emitProgress()
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ModePlain {
+		for _, line := range r.finished {
+			fmt.Fprintln(r.w, line)
+		}
+		r.finished = nil
+		fmt.Fprintln(r.w, r.plainLine(final))
+		return
+	}
+
+	width := 80
+	if w, _, err := term.GetSize(int(r.out.Fd())); err == nil && w > 20 {
+		width = w
+	}
+
+	var b []byte
+	if r.lines > 0 {
+		// Move to the top of the live block and clear it
+		b = fmt.Appendf(b, "\x1b[%dA", r.lines)
+	}
+	b = append(b, "\r\x1b[J"...)
+
+	// Finished files scroll up above the live block
+	for _, line := range r.finished {
+		b = append(b, line...)
+		b = append(b, '\n')
+	}
+	r.finished = nil
+
+	lines := 0
+	if !final {
+		for i, task := range r.tasks {
+			if i == maxActiveLines {
+				b = fmt.Appendf(b, "  ... and %d more\n", len(r.tasks)-maxActiveLines)
+				lines++
+				break
+			}
+			b = append(b, r.fileLine(task, width)...)
+			b = append(b, '\n')
+			lines++
+		}
+	}
+	b = append(b, r.overallLine(width, final)...)
+	b = append(b, '\n')
+	if !final {
+		lines++
+	}
+	r.lines = lines
+
+	r.w.Write(b)
+}
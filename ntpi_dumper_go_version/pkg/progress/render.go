@@ -0,0 +1,141 @@
+// Package progress - Line formatting for bars and plain output
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// fileLine formats one active file: name, bar, percentage, bytes and speed
+func (r *Renderer) fileLine(t *Task, width int) string {
+	current := t.current.Load()
+	stats := fmt.Sprintf(" %3.0f%% %9s/%-9s %11s", percent(current, t.size),
+		formatSize(current), formatSize(t.size), formatRate(current, time.Since(t.started)))
+
+	nameWidth := min(24, width/4)
+	barWidth := width - nameWidth - len(stats) - 5
+	return fmt.Sprintf("  %-*s %s%s", nameWidth, fit(t.name, nameWidth), bar(current, t.size, barWidth), stats)
+}
+
+// overallLine formats the bar over all bytes with file count and ETA
+func (r *Renderer) overallLine(width int, final bool) string {
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	done := r.done.Load()
+	elapsed := time.Since(r.start)
+
+	tail := fmt.Sprintf("ETA %s", formatETA(done, r.totalBytes, elapsed))
+	if final {
+		tail = fmt.Sprintf("in %s", formatDuration(elapsed))
+	}
+	stats := fmt.Sprintf(" %3.0f%% %9s/%-9s %11s  %d/%d files  %s", percent(done, r.totalBytes),
+		formatSize(done), formatSize(r.totalBytes), formatRate(done, elapsed), r.nDone, r.totalFiles, tail)
+
+	barWidth := width - len("Total ") - len(stats) - 3
+	return cyan("Total ") + bar(done, r.totalBytes, barWidth) + stats
+}
+
+// plainLine formats a log-friendly progress line
+func (r *Renderer) plainLine(final bool) string {
+	done := r.done.Load()
+	elapsed := time.Since(r.start)
+
+	if final {
+		return fmt.Sprintf("Progress: %.1f%% (%s / %s), %d/%d files, %s in %s",
+			percent(done, r.totalBytes), formatSize(done), formatSize(r.totalBytes),
+			r.nDone, r.totalFiles, formatRate(done, elapsed), formatDuration(elapsed))
+	}
+	return fmt.Sprintf("Progress: %.1f%% (%s / %s), %d/%d files, %d active, %s, ETA %s",
+		percent(done, r.totalBytes), formatSize(done), formatSize(r.totalBytes),
+		r.nDone, r.totalFiles, len(r.tasks), formatRate(done, elapsed), formatETA(done, r.totalBytes, elapsed))
+}
+
+// finishedLine formats the permanent line printed when a file completes
+func (r *Renderer) finishedLine(t *Task, err error) string {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	took := ""
+	if !t.started.IsZero() {
+		took = " in " + formatDuration(time.Since(t.started))
+	}
+	if err != nil {
+		return fmt.Sprintf("%s %s (%s)", red("Failed"), t.name, formatSize(t.size))
+	}
+	return fmt.Sprintf("%s %s (%s)%s", green("Done"), t.name, formatSize(t.size), took)
+}
+
+// bar draws a progress bar of the given width (including the brackets)
+func bar(current, total int64, width int) string {
+	inner := width - 2
+	if inner < 5 {
+		return ""
+	}
+
+	filled := inner
+	if total > 0 {
+		filled = int(int64(inner) * min(current, total) / total)
+	}
+	return "|" + strings.Repeat("=", filled) + strings.Repeat(" ", inner-filled) + "|"
+}
+
+// percent returns current as a percentage of total (100 for empty totals)
+func percent(current, total int64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return 100 * float64(current) / float64(total)
+}
+
+// fit truncates s to at most n characters
+func fit(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= 3 {
+		return s[:n]
+	}
+	return s[:n-3] + "..."
+}
+
+// formatSize formats a byte count compactly
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "kMGT"[exp])
+}
+
+// formatRate formats bytes over elapsed as a speed
+func formatRate(bytes int64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "-"
+	}
+	return formatSize(int64(float64(bytes)/elapsed.Seconds())) + "/s"
+}
+
+// formatETA estimates the remaining time from the average speed so far
+func formatETA(done, total int64, elapsed time.Duration) string {
+	if done <= 0 || elapsed <= 0 {
+		return "--"
+	}
+	remaining := time.Duration(float64(total-done) / float64(done) * float64(elapsed))
+	return formatDuration(remaining)
+}
+
+// formatDuration formats a duration in whole seconds (or tenths below a minute)
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
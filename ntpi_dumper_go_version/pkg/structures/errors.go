@@ -0,0 +1,11 @@
+// Package structures - Sentinel errors for binary structure parsing
+package structures
+
+import "errors"
+
+var (
+	// ErrBadMagic is returned when a header does not start with the expected magic bytes
+	ErrBadMagic = errors.New("invalid magic")
+	// ErrShortData is returned when there are not enough bytes to parse a header
+	ErrShortData = errors.New("data too small")
+)
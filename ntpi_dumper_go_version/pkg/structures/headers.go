@@ -109,7 +109,7 @@ func (h *NTDecompressHeader) IsValid() bool {
 // ParseNTPIHeader parses NTPI header from byte slice
 func ParseNTPIHeader(data []byte) (*NTPIHeader, error) {
 	if len(data) < 48 {
-		return nil, fmt.Errorf("data too small for NTPI header: %d bytes", len(data))
+		return nil, fmt.Errorf("%w for NTPI header: %d bytes", ErrShortData, len(data))
 	}
 
 	header := &NTPIHeader{}
@@ -120,7 +120,7 @@ func ParseNTPIHeader(data []byte) (*NTPIHeader, error) {
 	}
 
 	if !header.IsValid() {
-		return nil, fmt.Errorf("invalid NTPI magic: %s", string(header.Magic[:]))
+		return nil, fmt.Errorf("%w for NTPI header: %q", ErrBadMagic, string(header.Magic[:]))
 	}
 
 	return header, nil
@@ -129,7 +129,7 @@ func ParseNTPIHeader(data []byte) (*NTPIHeader, error) {
 // ParseRegionHeader parses region header from byte slice
 func ParseRegionHeader(data []byte) (*RegionHeader, error) {
 	if len(data) < 16 {
-		return nil, fmt.Errorf("data too small for region header: %d bytes", len(data))
+		return nil, fmt.Errorf("%w for region header: %d bytes", ErrShortData, len(data))
 	}
 
 	header := &RegionHeader{}
@@ -145,7 +145,7 @@ func ParseRegionHeader(data []byte) (*RegionHeader, error) {
 // ParseRegionBlockHeader parses region block header from byte slice
 func ParseRegionBlockHeader(data []byte) (*RegionBlockHeader, error) {
 	if len(data) < 40 {
-		return nil, fmt.Errorf("data too small for region block header: %d bytes", len(data))
+		return nil, fmt.Errorf("%w for region block header: %d bytes", ErrShortData, len(data))
 	}
 
 	header := &RegionBlockHeader{}
@@ -161,7 +161,7 @@ func ParseRegionBlockHeader(data []byte) (*RegionBlockHeader, error) {
 // ParseNTEncodeHeader parses NTEncode header from byte slice
 func ParseNTEncodeHeader(data []byte) (*NTEncodeHeader, error) {
 	if len(data) < 112 {
-		return nil, fmt.Errorf("data too small for NTEncode header: %d bytes", len(data))
+		return nil, fmt.Errorf("%w for NTEncode header: %d bytes", ErrShortData, len(data))
 	}
 
 	header := &NTEncodeHeader{}
@@ -172,7 +172,7 @@ func ParseNTEncodeHeader(data []byte) (*NTEncodeHeader, error) {
 	}
 
 	if !header.IsValid() {
-		return nil, fmt.Errorf("invalid NTEncode magic: %s", string(header.Magic[:]))
+		return nil, fmt.Errorf("%w for NTEncode header: %q", ErrBadMagic, string(header.Magic[:]))
 	}
 
 	return header, nil
@@ -181,7 +181,7 @@ func ParseNTEncodeHeader(data []byte) (*NTEncodeHeader, error) {
 // ParseNTDecompressHeader parses NTDecompress header from byte slice
 func ParseNTDecompressHeader(data []byte) (*NTDecompressHeader, error) {
 	if len(data) < 112 {
-		return nil, fmt.Errorf("data too small for NTDecompress header: %d bytes", len(data))
+		return nil, fmt.Errorf("%w for NTDecompress header: %d bytes", ErrShortData, len(data))
 	}
 
 	header := &NTDecompressHeader{}
@@ -192,7 +192,7 @@ func ParseNTDecompressHeader(data []byte) (*NTDecompressHeader, error) {
 	}
 
 	if !header.IsValid() {
-		return nil, fmt.Errorf("invalid NTDecompress magic: %s", string(header.Magic[:]))
+		return nil, fmt.Errorf("%w for NTDecompress header: %q", ErrBadMagic, string(header.Magic[:]))
 	}
 
 	return header, nil
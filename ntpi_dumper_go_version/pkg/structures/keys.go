@@ -41,23 +41,33 @@ var DefaultAESDict = AESDict_V1_3_0
 
 // GetAESDictForVersion returns the AES key dictionary for a specific version
 func GetAESDictForVersion(major, minor, patch uint64) *AESKeyDict {
+	if dict, ok := FindAESDictForVersion(major, minor, patch); ok {
+		return dict
+	}
+
+	// Return default if no match found
+	return DefaultAESDict
+}
+
+// FindAESDictForVersion looks up the key dictionary for a version and reports
+// whether the version is known, instead of silently falling back to the default
+func FindAESDictForVersion(major, minor, patch uint64) (*AESKeyDict, bool) {
 	version := fmt.Sprintf("%d.%d.%d", major, minor, patch)
 
 	// Try exact match
 	if dict, ok := VersionKeyMap[version]; ok {
-		return dict
+		return dict, true
 	}
 
 	// Try partial match (major.minor)
 	partialVersion := fmt.Sprintf("%d.%d", major, minor)
 	for key, dict := range VersionKeyMap {
 		if len(key) >= len(partialVersion) && key[:len(partialVersion)] == partialVersion {
-			return dict
+			return dict, true
 		}
 	}
 
-	// Return default if no match found
-	return DefaultAESDict
+	return nil, false
 }
 
 // GetKeyForRegion returns the AES key for a specific region type
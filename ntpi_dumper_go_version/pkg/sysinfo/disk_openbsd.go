@@ -0,0 +1,16 @@
+//go:build openbsd
+// +build openbsd
+
+package sysinfo
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the free space available to unprivileged users. OpenBSD's
+// Statfs_t prefixes its fields with F_.
+func diskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.F_bavail) * uint64(stat.F_bsize), nil
+}
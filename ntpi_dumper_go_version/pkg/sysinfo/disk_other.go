@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !windows
+// +build !linux,!darwin,!freebsd,!openbsd,!windows
+
+package sysinfo
+
+// diskFree is not implemented on this platform
+func diskFree(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
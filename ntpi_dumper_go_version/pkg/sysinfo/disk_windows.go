@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package sysinfo
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the free space available to the calling user
+func diskFree(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytes, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytes, &totalBytes, &totalFreeBytes); err != nil {
+		return 0, err
+	}
+	return freeBytes, nil
+}
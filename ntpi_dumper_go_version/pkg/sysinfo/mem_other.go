@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package sysinfo
+
+// availableMemory is not implemented on this platform
+func availableMemory() (uint64, error) {
+	return 0, ErrUnsupported
+}
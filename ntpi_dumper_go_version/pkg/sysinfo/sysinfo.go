@@ -0,0 +1,40 @@
+// Package sysinfo queries free disk space and available memory for preflight checks
+package sysinfo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsupported is returned when a value cannot be queried on this platform
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// DiskFree returns the number of bytes available to the current user on the
+// filesystem holding path. If path does not exist yet, its nearest existing
+// parent directory is used instead.
+func DiskFree(path string) (uint64, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		if _, err := os.Stat(absPath); err == nil {
+			break
+		}
+		parent := filepath.Dir(absPath)
+		if parent == absPath {
+			break
+		}
+		absPath = parent
+	}
+
+	return diskFree(absPath)
+}
+
+// AvailableMemory returns the amount of physical memory that can be used
+// without pushing the system into swap
+func AvailableMemory() (uint64, error) {
+	return availableMemory()
+}